@@ -2,42 +2,57 @@ package main
 
 import (
 	"fmt"
+	"strconv"
 )
 
-func (c *Controller) ListAccounts() {
-	accountsSlice, err := c.Api.GetAccounts()
+func (c *Controller) ListAccounts() error {
+	accountsSlice, err := c.Api.GetAccounts(c.Context)
 
 	if err != nil {
-		fmt.Println("Error retreiving accounts: " + err.Error())
-		cliOSExit()
-		return
+		return fmt.Errorf("Error retreiving accounts: %w", err)
 	}
 
-	fmt.Println("== Accounts")
+	if c.Format != formatText {
+		rows := table{headers: []string{"SLUG", "NAME", "OWNER", "EMAIL", "DEFAULT"}}
+		for _, account := range accountsSlice {
+			rows.add(account.Slug, account.Name, account.OwnerName, account.OwnerEmail, strconv.FormatBool(c.Api.AccountSlug == account.Slug))
+		}
+		return c.render(accountsSlice, rows)
+	}
+
+	fmt.Fprintln(c.Out, "== Accounts")
 	for _, account := range accountsSlice {
-		if c.Api.Config.AccountSlug == account.Slug { // signify it is the default account
-			fmt.Println(account.Slug + " (default)")
+		if c.Api.AccountSlug == account.Slug { // signify it is the default account
+			fmt.Fprintln(c.Out, account.Slug+" (default)")
 		} else {
-			fmt.Println(account.Slug)
+			fmt.Fprintln(c.Out, account.Slug)
 		}
 	}
+	return nil
 }
 
-func (c *Controller) ShowAccount(slug string) {
-	account, err := c.Api.GetAccount(slug)
+func (c *Controller) ShowAccount(slug string) error {
+	account, err := c.Api.GetAccount(c.Context, slug)
 
 	if err != nil {
-		fmt.Println("Error retreiving account: " + err.Error())
-		cliOSExit()
-		return
+		return fmt.Errorf("Error retreiving account: %w", err)
+	}
+
+	if c.Format != formatText {
+		rows := table{headers: []string{"NAME", "EMAIL"}}
+		for _, user := range account.Users {
+			rows.add(user.Name, user.Email)
+		}
+		return c.render(account, rows)
 	}
 
-	fmt.Println("== " + slug)
-	fmt.Println(" slug:    " + account.Slug)
-	fmt.Println(" name:    " + account.Name)
-	fmt.Println(" owner:   " + account.OwnerName + " (" + account.OwnerEmail + ") ")
-	fmt.Println(" == Users")
+	fmt.Fprintln(c.Out, "== "+slug)
+	fmt.Fprintln(c.Out, " slug:    "+account.Slug)
+	fmt.Fprintln(c.Out, " name:    "+account.Name)
+	fmt.Fprintln(c.Out, " owner:   "+account.OwnerName+" ("+account.OwnerEmail+") ")
+	fmt.Fprintln(c.Out, " == Users")
 	for _, user := range account.Users {
-		fmt.Println("    " + user.Name + " (" + user.Email + ") ")
+		fmt.Fprintln(c.Out, "    "+user.Name+" ("+user.Email+") ")
 	}
+	return nil
 }
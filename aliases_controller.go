@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+func (c *Controller) ListAliases() error {
+	aliases := userAliases()
+
+	if c.Format != formatText {
+		rows := table{headers: []string{"ALIAS", "COMMAND", "ORIGIN"}}
+		for _, alias := range aliases {
+			rows.add(alias.Name, alias.Command, alias.Origin)
+		}
+		return c.render(aliases, rows)
+	}
+
+	fmt.Fprintln(c.Out, "== Aliases")
+	if len(aliases) == 0 {
+		fmt.Fprintln(c.Out, "No aliases.  Add one with aliases:set.")
+	}
+	for _, alias := range aliases {
+		fmt.Fprintln(c.Out, alias.Name+" = "+alias.Command)
+	}
+	return nil
+}
+
+// SetAlias saves an alias for every profile.  The command line has already
+// been checked with validateAlias.
+func (c *Controller) SetAlias(name, command string) error {
+	err := updateConfigFile(aliasFile, func(config *Config) error {
+		if config.Aliases == nil {
+			config.Aliases = map[string]string{}
+		}
+		config.Aliases[name] = command
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Error saving alias: %w", err)
+	}
+	fmt.Fprintln(c.Out, "Saved alias "+name+" for `mongohq "+command+"`.")
+
+	if project, err := findProjectConfig(); err == nil && project != nil && project.Aliases[name] != "" {
+		fmt.Fprintln(c.Out, "In this project it is overridden by "+project.Path+", which sets it to `mongohq "+project.Aliases[name]+"`.")
+	}
+	return nil
+}
+
+func (c *Controller) RemoveAlias(name string) error {
+	var errNoAlias = errors.New("No alias named " + name + ".")
+	err := updateConfigFile(aliasFile, func(config *Config) error {
+		if _, ok := config.Aliases[name]; !ok {
+			return errNoAlias
+		}
+		delete(config.Aliases, name)
+		return nil
+	})
+
+	if err == errNoAlias {
+		if project, err := findProjectConfig(); err == nil && project != nil && project.Aliases[name] != "" {
+			return errors.New("Alias " + name + " is defined in " + project.Path + "; edit that file to remove it.")
+		}
+		return err
+	} else if err != nil {
+		return fmt.Errorf("Error removing alias: %w", err)
+	}
+	fmt.Fprintln(c.Out, "Removed alias "+name+".")
+	return nil
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"errors"
+	"github.com/codegangsta/cli"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The command line is rewritten before the app parses it, for each run and
+// each line typed in the shell: aliases, from aliases:set and the project
+// file, are expanded, then flags missing from the command line are filled
+// in from MONGOHQ_* variables.
+
+// expandAlias replaces an alias given as the command with the command line
+// it stands for, keeping the global flags before it and the arguments
+// after it.  Global flags in the alias, such as --format, are moved in
+// front of the command, where they have to be.  Commands take precedence
+// over aliases of the same name.
+func expandAlias(app *cli.App, args []string, aliases map[string]string) []string {
+	position := commandPosition(app, args)
+	if position < 0 {
+		return args
+	}
+
+	name := args[position]
+	expansion, ok := aliases[name]
+	if !ok || app.Command(name) != nil || name == "help" || name == "h" {
+		return args
+	}
+
+	var globals, command []string
+	words := strings.Fields(expansion)
+	for i := 0; i < len(words); i++ {
+		isGlobal, takesValue := findFlag(app.Flags, words[i])
+		if !isGlobal {
+			command = append(command, words[i])
+			continue
+		}
+
+		globals = append(globals, words[i])
+		if takesValue && i+1 < len(words) {
+			i++
+			globals = append(globals, words[i])
+		}
+	}
+
+	expanded := append([]string{}, args[:position]...)
+	expanded = append(expanded, globals...)
+	expanded = append(expanded, command...)
+	return append(expanded, args[position+1:]...)
+}
+
+var aliasNameRegex = regexp.MustCompile("^[A-Za-z0-9][A-Za-z0-9_:.-]*$")
+
+// validateAlias checks an alias before it is saved.  It has to run a
+// command, as aliases are expanded once and cannot name other aliases, and
+// it cannot take the name of a command, which would win over it.
+func validateAlias(app *cli.App, name, command string) error {
+	if !aliasNameRegex.MatchString(name) {
+		return errors.New("Alias names may only contain letters, numbers, dashes, underscores, dots and colons.")
+	} else if app.Command(name) != nil || name == "help" || name == "h" {
+		return errors.New(name + " is already a mongohq command.")
+	}
+
+	args := append([]string{"mongohq"}, strings.Fields(command)...)
+	position := commandPosition(app, args)
+	if position < 0 {
+		return errors.New("An alias needs a command to run, such as `mongostat --deployment <deployment>`.")
+	} else if app.Command(args[position]) == nil {
+		return errors.New("`" + args[position] + "` is not a mongohq command.  See `mongohq help` for a list of available commands.")
+	}
+	return nil
+}
+
+// closestCommand suggests the command or alias a mistyped name was most
+// likely meant to be, or returns "" when nothing is close.
+func closestCommand(app *cli.App, name string, aliases map[string]string) string {
+	var candidates []string
+	for _, command := range app.Commands {
+		candidates = append(candidates, command.Name)
+		if command.ShortName != "" {
+			candidates = append(candidates, command.ShortName)
+		}
+	}
+	for alias := range aliases {
+		candidates = append(candidates, alias)
+	}
+	sort.Strings(candidates)
+
+	best, bestDistance := "", len(name)/3+2
+	for _, candidate := range candidates {
+		distance := editDistance(strings.ToLower(name), strings.ToLower(candidate))
+		if distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+func minInt(first int, rest ...int) int {
+	for _, value := range rest {
+		if value < first {
+			first = value
+		}
+	}
+	return first
+}
+
+// environmentFlagNames are the flags filled in from their MONGOHQ_*
+// variable when they are missing from the command line.  Only flags that
+// tune how a command runs are listed: a variable with a name as general as
+// MONGOHQ_NAME or MONGOHQ_ID must not pick what a command acts on, filter
+// what it shows, or answer for the user.  The config keys have variables
+// of their own, which apply where the config defaults do, and the other
+// global flags read theirs when they are checked.
+var environmentFlagNames = []string{"retry-non-idempotent", "show-origin", "web", "device"}
+
+// environmentName is the variable that stands in for a flag or config key,
+// such as MONGOHQ_SOURCE_DATABASE for --source-database.
+func environmentName(name string) string {
+	return "MONGOHQ_" + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+// applyEnvironment adds the environmentFlagNames flags missing from args
+// whose MONGOHQ_* variable is set.
+func applyEnvironment(app *cli.App, args []string) ([]string, error) {
+	position := commandPosition(app, args)
+	if position < 0 {
+		position = len(args)
+	}
+
+	globals, err := environmentFlags(app.Flags, args[1:position])
+	if err != nil {
+		return nil, err
+	}
+
+	var commandFlags []string
+	if position < len(args) {
+		if command := app.Command(args[position]); command != nil {
+			commandFlags, err = environmentFlags(command.Flags, args[position+1:])
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	applied := append([]string{}, args[:position]...)
+	applied = append(applied, globals...)
+	if position < len(args) {
+		applied = append(applied, args[position])
+		applied = append(applied, commandFlags...)
+		applied = append(applied, args[position+1:]...)
+	}
+	return applied, nil
+}
+
+func environmentFlags(flags []cli.Flag, given []string) ([]string, error) {
+	var added []string
+	for _, flag := range flags {
+		names, takesValue := flagNames(flag)
+		if len(names) == 0 || !stringInSlice(names[0], environmentFlagNames) || flagGiven(names, given) {
+			continue
+		}
+
+		variable := environmentName(names[0])
+		value := os.Getenv(variable)
+		if value == "" {
+			continue
+		}
+
+		if takesValue {
+			added = append(added, "--"+names[0], value)
+		} else if enabled, err := strconv.ParseBool(value); err != nil {
+			return nil, errors.New(variable + " must be true or false")
+		} else if enabled {
+			added = append(added, "--"+names[0])
+		}
+	}
+	return added, nil
+}
+
+func flagGiven(names []string, given []string) bool {
+	for _, arg := range given {
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name := strings.TrimLeft(arg, "-")
+		if equals := strings.Index(name, "="); equals >= 0 {
+			name = name[:equals]
+		}
+		if stringInSlice(name, names) {
+			return true
+		}
+	}
+	return false
+}
+
+// commandPosition finds the command in args, skipping the program name
+// and any global flags and their values.  It is -1 when there is no
+// command.
+func commandPosition(app *cli.App, args []string) int {
+	for i := 1; i < len(args); i++ {
+		isGlobal, takesValue := findFlag(app.Flags, args[i])
+		if !isGlobal && !strings.HasPrefix(args[i], "-") {
+			return i
+		} else if takesValue {
+			i++ // skip the value
+		}
+	}
+	return -1
+}
+
+// findFlag reports whether arg is one of flags, and whether a value follows
+// it as the next argument.
+func findFlag(flags []cli.Flag, arg string) (found, takesValue bool) {
+	if !strings.HasPrefix(arg, "-") {
+		return false, false
+	}
+	name := strings.TrimLeft(arg, "-")
+	if equals := strings.Index(name, "="); equals >= 0 {
+		name = name[:equals]
+	}
+
+	for _, flag := range flags {
+		if names, valued := flagNames(flag); stringInSlice(name, names) {
+			return true, valued && !strings.Contains(arg, "=")
+		}
+	}
+	return false, false
+}
+
+// flagNames lists a flag's names, long name first, and whether it takes a
+// value.
+func flagNames(flag cli.Flag) (names []string, takesValue bool) {
+	var name string
+	switch f := flag.(type) {
+	case cli.StringFlag:
+		name, takesValue = f.Name, true
+	case cli.IntFlag:
+		name, takesValue = f.Name, true
+	case cli.BoolFlag:
+		name = f.Name
+	default:
+		return nil, false
+	}
+
+	for _, part := range strings.Split(name, ",") {
+		names = append(names, strings.TrimSpace(part))
+	}
+	return names, takesValue
+}
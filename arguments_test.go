@@ -0,0 +1,166 @@
+package main
+
+import (
+	"github.com/MongoHQ/mongohq-cli/mongohq"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyEnvironment(t *testing.T) {
+	isolate(t)
+	t.Setenv("MONGOHQ_RETRY_NON_IDEMPOTENT", "true")
+	t.Setenv("MONGOHQ_SHOW_ORIGIN", "true")
+	app := newApp()
+
+	tests := []struct {
+		args, want []string
+	}{
+		{[]string{"mongohq", "config:list"}, []string{"mongohq", "--retry-non-idempotent", "config:list", "--show-origin"}},
+		{[]string{"mongohq", "--retry-non-idempotent", "config:list", "--show-origin"}, []string{"mongohq", "--retry-non-idempotent", "config:list", "--show-origin"}},
+		{[]string{"mongohq", "--format", "json", "accounts"}, []string{"mongohq", "--format", "json", "--retry-non-idempotent", "accounts"}},
+		{[]string{"mongohq"}, []string{"mongohq", "--retry-non-idempotent"}},
+	}
+	for _, test := range tests {
+		got, err := applyEnvironment(app, test.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("applyEnvironment(%q) = %q, want %q", test.args, got, test.want)
+		}
+	}
+
+	t.Setenv("MONGOHQ_SHOW_ORIGIN", "sometimes")
+	if _, err := applyEnvironment(app, []string{"mongohq", "config:list"}); err == nil || err.Error() != "MONGOHQ_SHOW_ORIGIN must be true or false" {
+		t.Errorf("got error %v for a bad boolean", err)
+	}
+}
+
+// Variables with names as general as these are easily set for something
+// else, and must never choose what a command acts on, filter its output,
+// or answer for the user.
+var unmappedVariables = []string{
+	"MONGOHQ_ID", "MONGOHQ_PASSWORD", "MONGOHQ_USERNAME", "MONGOHQ_NAME", "MONGOHQ_KEY", "MONGOHQ_VALUE",
+	"MONGOHQ_URL", "MONGOHQ_TO", "MONGOHQ_COMMAND", "MONGOHQ_BACKUP", "MONGOHQ_FORCE", "MONGOHQ_DESCRIPTION",
+	"MONGOHQ_LOCATION", "MONGOHQ_STATUS", "MONGOHQ_PLAN", "MONGOHQ_VERSION", "MONGOHQ_COLUMNS", "MONGOHQ_SORT",
+	"MONGOHQ_ALL_ACCOUNTS", "MONGOHQ_SEARCH", "MONGOHQ_EXCLUDE", "MONGOHQ_REGEXP", "MONGOHQ_SOURCE_DATABASE",
+	"MONGOHQ_DESTINATION_DATABASE", "MONGOHQ_ACCOUNT", "MONGOHQ_DEPLOYMENT", "MONGOHQ_DATABASE",
+}
+
+func TestApplyEnvironmentLeavesCommandsAlone(t *testing.T) {
+	isolate(t)
+	for _, variable := range unmappedVariables {
+		t.Setenv(variable, "true")
+	}
+
+	app := newApp()
+	for _, command := range app.Commands {
+		args := []string{"mongohq", command.Name}
+		got, err := applyEnvironment(app, args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, args) {
+			t.Errorf("applyEnvironment(%q) = %q", args, got)
+		}
+	}
+}
+
+// TestDeploymentFiltersIgnoreEnvironment sets the variables a
+// deployments:create run might leave behind, which must not narrow the
+// deployments listing.
+func TestDeploymentFiltersIgnoreEnvironment(t *testing.T) {
+	server := newTestServer(t)
+	addDeployments(server)
+	t.Setenv("MONGOHQ_LOCATION", "rackspace:dfw")
+	t.Setenv("MONGOHQ_STATUS", "stopped")
+	t.Setenv("MONGOHQ_PLAN", "dedicated")
+	t.Setenv("MONGOHQ_VERSION", "2.4")
+
+	r := runCommand(t, "deployments", "--columns", "name")
+	if r.status != 0 {
+		t.Fatalf("exited %d: %s", r.status, r.stderr)
+	}
+	for _, name := range []string{"test-deployment", "staging", "archive"} {
+		if !strings.Contains(r.stdout, name) {
+			t.Errorf("%s is missing from the listing:\n%s", name, r.stdout)
+		}
+	}
+}
+
+// TestGlobalFlagVariables covers the global flags whose variables are read
+// where the flag is, rather than through applyEnvironment or the config
+// keys.
+func TestGlobalFlagVariables(t *testing.T) {
+	server := newTestServer(t)
+	os.Unsetenv("MONGOHQ_API_TOKEN")
+	t.Setenv("MONGOHQ_TOKEN", server.Token)
+
+	if r := runCommand(t, "accounts"); r.status != 0 {
+		t.Fatalf("with MONGOHQ_TOKEN, exited %d: %s", r.status, r.stderr)
+	}
+
+	t.Setenv("MONGOHQ_VERBOSE", "true")
+	if r := runCommand(t, "accounts"); !strings.Contains(r.stderr, "> GET "+server.URL+"/accounts") {
+		t.Errorf("MONGOHQ_VERBOSE did not trace to stderr:\n%s", r.stderr)
+	}
+	t.Setenv("MONGOHQ_VERBOSE", "sometimes")
+	if r := runCommand(t, "accounts"); r.status == 0 || !strings.Contains(r.stderr, "MONGOHQ_VERBOSE must be true or false") {
+		t.Errorf("with a bad MONGOHQ_VERBOSE, exited %d: %s", r.status, r.stderr)
+	}
+	os.Unsetenv("MONGOHQ_VERBOSE")
+
+	t.Setenv("MONGOHQ_TRACE_FILE", "trace.log")
+	runCommand(t, "accounts")
+	if trace, err := ioutil.ReadFile("trace.log"); err != nil || !strings.Contains(string(trace), "> GET "+server.URL+"/accounts") {
+		t.Errorf("MONGOHQ_TRACE_FILE gave %q, %v", trace, err)
+	}
+}
+
+// TestPrecedence runs deployments:info with the deployment given by each
+// source in turn, removing the winner each time: flag, then MONGOHQ_*
+// variable, then project file, then the profile's defaults.
+func TestPrecedence(t *testing.T) {
+	server := newTestServer(t)
+	for _, name := range []string{"from-flag", "from-env", "from-project", "from-profile"} {
+		server.Deployments["test-account"] = append(server.Deployments["test-account"],
+			mongohq.Deployment{Id: name, Name: name, Plan: "elastic", Location: "aws:us-east-1", Status: "running", Version: "2.6.3"})
+	}
+
+	if err := updateConfig(func(config *Config) error {
+		config.DeploymentSlug = "from-profile"
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(".mongohq.yml", []byte("deployment: from-project\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("MONGOHQ_DEPLOYMENT", "from-env")
+
+	deploymentShown := func(args ...string) string {
+		r := runCommand(t, args...)
+		if r.status != 0 {
+			t.Fatalf("mongohq %s exited %d: %s", strings.Join(args, " "), r.status, r.stderr)
+		}
+		return strings.SplitN(r.stdout, "\n", 2)[0]
+	}
+
+	if got := deploymentShown("deployments:info", "--deployment", "from-flag"); got != "== from-flag" {
+		t.Errorf("with a flag, showed %q", got)
+	}
+	if got := deploymentShown("deployments:info"); got != "== from-env" {
+		t.Errorf("with MONGOHQ_DEPLOYMENT, showed %q", got)
+	}
+	os.Unsetenv("MONGOHQ_DEPLOYMENT")
+	if got := deploymentShown("deployments:info"); got != "== from-project" {
+		t.Errorf("with a project file, showed %q", got)
+	}
+	os.Remove(".mongohq.yml")
+	if got := deploymentShown("deployments:info"); got != "== from-profile" {
+		t.Errorf("with the profile's default, showed %q", got)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+func (c *Controller) ListAuthorizations() error {
+	authorizations, err := c.Api.GetAuthorizations(c.Context)
+
+	if err != nil {
+		return fmt.Errorf("Error retrieving tokens: %w", err)
+	}
+
+	if c.Format != formatText {
+		rows := table{headers: []string{"ID", "CLIENT", "DESCRIPTION", "CREATED AT", "LAST USED AT", "CURRENT"}}
+		for _, authorization := range authorizations {
+			rows.add(authorization.Id, authorization.Client, authorization.Description, authorization.CreatedAt, authorization.LastUsedAt, strconv.FormatBool(authorization.Current))
+		}
+		return c.render(authorizations, rows)
+	}
+
+	fmt.Fprintln(c.Out, "== Tokens")
+	for _, authorization := range authorizations {
+		if authorization.Current { // signify the token this CLI is using
+			fmt.Fprintln(c.Out, authorization.Id+" (current)")
+		} else {
+			fmt.Fprintln(c.Out, authorization.Id)
+		}
+		fmt.Fprintln(c.Out, " client       : "+authorization.Client)
+		if authorization.Description != "" {
+			fmt.Fprintln(c.Out, " description  : "+authorization.Description)
+		}
+		fmt.Fprintln(c.Out, " created at   : "+authorization.CreatedAt)
+		if authorization.LastUsedAt == "" {
+			fmt.Fprintln(c.Out, " last used at : never")
+		} else {
+			fmt.Fprintln(c.Out, " last used at : "+authorization.LastUsedAt)
+		}
+	}
+	return nil
+}
+
+func (c *Controller) CreateAuthorization(description string) error {
+	authorization, err := c.Api.CreateAuthorization(c.Context, description)
+
+	if err != nil {
+		return fmt.Errorf("Error creating token: %w", err)
+	}
+
+	if c.Format != formatText {
+		rows := table{headers: []string{"ID", "DESCRIPTION", "TOKEN"}}
+		rows.add(authorization.Id, authorization.Description, authorization.Token)
+		return c.render(authorization, rows)
+	}
+
+	fmt.Fprintln(c.Out, "== Token "+authorization.Id)
+	fmt.Fprintln(c.Out, " description : "+authorization.Description)
+	fmt.Fprintln(c.Out, " token       : "+authorization.Token)
+	fmt.Fprintln(c.Out, "\nThis token will not be shown again.  Use it with MONGOHQ_API_TOKEN or --token, and revoke it with auth:revoke --id "+authorization.Id+".")
+	return nil
+}
+
+func (c *Controller) RevokeAuthorization(id string) error {
+	authorizations, err := c.Api.GetAuthorizations(c.Context)
+
+	if err != nil {
+		return fmt.Errorf("Error retrieving tokens: %w", err)
+	}
+
+	var current bool
+	for _, authorization := range authorizations {
+		if authorization.Id == id {
+			current = authorization.Current
+		}
+	}
+
+	err = c.Api.RevokeAuthorization(c.Context, id)
+
+	if err != nil {
+		return fmt.Errorf("Error revoking token: %w", err)
+	}
+
+	fmt.Fprintln(c.Out, "Revoked token "+id+".")
+	if current {
+		fmt.Fprintln(c.Out, "That was the token this CLI was using; the next command will ask you to log in again.")
+	}
+	return nil
+}
@@ -1,115 +1,174 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"github.com/MongoHQ/mongohq-cli/mongohq"
 	"strings"
 )
 
-func (c *Controller) ListBackups() {
-	backupsSlice, err := c.Api.GetBackups()
+func (c *Controller) ListBackups() error {
+	backupsSlice, err := c.Api.GetBackups(c.Context)
 
 	if err != nil {
-		fmt.Println("Error retreiving backups: " + err.Error())
-		cliOSExit()
-		return
+		return fmt.Errorf("Error retreiving backups: %w", err)
 	}
 
-	fmt.Println("== Backups")
+	if c.Format != formatText {
+		return c.render(backupsSlice, backupsTable(backupsSlice))
+	}
+
+	fmt.Fprintln(c.Out, "== Backups")
 	for _, backup := range backupsSlice {
-		fmt.Println(backup.Filename)
+		fmt.Fprintln(c.Out, backup.Filename)
+	}
+	return nil
+}
+
+// accountBackup tags a backup with its account, for --all-accounts.
+type accountBackup struct {
+	Account string `json:"account"`
+	mongohq.Backup
+}
+
+// ListBackupsForAllAccounts lists the backups of every account, fetching
+// them concurrently.  Accounts that fail are reported after the others are
+// listed.
+func (c *Controller) ListBackupsForAllAccounts() error {
+	accounts, err := c.Api.GetAccounts(c.Context)
+	if err != nil {
+		return fmt.Errorf("Error retrieving accounts: %w", err)
+	}
+
+	results := make([][]mongohq.Backup, len(accounts))
+	fetchErr := c.eachAccount(accounts, func(i int, api *mongohq.Api) (err error) {
+		results[i], err = api.GetBackups(c.Context)
+		return err
+	})
+
+	var backups []accountBackup
+	for i, account := range accounts {
+		for _, backup := range results[i] {
+			backups = append(backups, accountBackup{Account: account.Slug, Backup: backup})
+		}
+	}
+
+	if c.Format != formatText {
+		rows := table{headers: []string{"ACCOUNT", "ID", "FILENAME", "DEPLOYMENT", "STATUS", "SIZE", "CREATED AT"}}
+		for _, backup := range backups {
+			rows.add(backup.Account, backup.Id, backup.Filename, backup.DeploymentSlug, backup.Status, backup.PrettySize(), backup.CreatedAt)
+		}
+		if err := c.render(backups, rows); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintln(c.Out, "== Backups")
+		for _, backup := range backups {
+			fmt.Fprintln(c.Out, backup.Filename+" ("+backup.Account+")")
+		}
 	}
+	return fetchErr
 }
 
-func (c *Controller) ListBackupsForDeployment(deploymentSlug string) {
-	backupsSlice, err := c.Api.GetBackupsForDeployment(deploymentSlug)
+func (c *Controller) ListBackupsForDeployment(deploymentSlug string) error {
+	backupsSlice, err := c.Api.GetBackupsForDeployment(c.Context, deploymentSlug)
 
 	if err != nil {
-		fmt.Println("Error retreiving backups: " + err.Error())
-		cliOSExit()
-		return
+		return fmt.Errorf("Error retreiving backups: %w", err)
 	}
 
-	fmt.Println("== Backups for " + deploymentSlug)
+	if c.Format != formatText {
+		return c.render(backupsSlice, backupsTable(backupsSlice))
+	}
+
+	fmt.Fprintln(c.Out, "== Backups for "+deploymentSlug)
 	for _, backup := range backupsSlice {
-		fmt.Println(backup.Filename)
+		fmt.Fprintln(c.Out, backup.Filename)
 	}
+	return nil
 }
 
-func (c *Controller) ShowBackup(backupSlug string) {
-	backup, err := c.Api.GetBackup(backupSlug)
+func (c *Controller) ShowBackup(backupSlug string) error {
+	backup, err := c.Api.GetBackup(c.Context, backupSlug)
 	if err != nil {
-		fmt.Println("Error retreiving backup: " + err.Error())
-		cliOSExit()
-		return
-	}
-	deployment, _ := c.Api.GetDeployment(backup.DeploymentSlug)
-	fmt.Println("== Backup " + backupSlug)
-	fmt.Println(" deployment : " + deployment.Name)
-	fmt.Println(" databases  : " + strings.Join(backup.DatabaseNames, ", "))
-	fmt.Println(" status     : " + backup.Status)
-	fmt.Println(" created at : " + backup.CreatedAt)
-	fmt.Println(" type       : " + backup.Type)
-	fmt.Println(" size       : " + backup.PrettySize())
+		return fmt.Errorf("Error retreiving backup: %w", err)
+	}
+	if c.Format != formatText {
+		return c.render(backup, backupsTable([]mongohq.Backup{backup}))
+	}
+
+	deployment, _ := c.Api.GetDeployment(c.Context, backup.DeploymentSlug)
+	fmt.Fprintln(c.Out, "== Backup "+backupSlug)
+	fmt.Fprintln(c.Out, " deployment : "+deployment.Name)
+	fmt.Fprintln(c.Out, " databases  : "+strings.Join(backup.DatabaseNames, ", "))
+	fmt.Fprintln(c.Out, " status     : "+backup.Status)
+	fmt.Fprintln(c.Out, " created at : "+backup.CreatedAt)
+	fmt.Fprintln(c.Out, " type       : "+backup.Type)
+	fmt.Fprintln(c.Out, " size       : "+backup.PrettySize())
 	if backup.Status == "complete" {
-		fmt.Println(" download   : " + backup.DownloadLink())
+		fmt.Fprintln(c.Out, " download   : "+backup.DownloadLink())
 	}
+	return nil
 }
 
-func (c *Controller) RestoreBackup(backupSlug, deploymentName, source, destination string) {
-	backup, err := c.Api.GetBackup(backupSlug)
+func (c *Controller) RestoreBackup(backupSlug, deploymentName, source, destination string) error {
+	backup, err := c.Api.GetBackup(c.Context, backupSlug)
 	if err != nil {
-		fmt.Println("Error retreiving backup: " + err.Error())
-		cliOSExit()
-		return
+		return fmt.Errorf("Error retreiving backup: %w", err)
 	}
 
-	deployment, err := c.Api.RestoreBackup(backup, deploymentName, source, destination)
+	deployment, err := c.Api.RestoreBackup(c.Context, backup, deploymentName, source, destination)
 	if err != nil {
-		fmt.Println("Error restoring backup: " + err.Error())
-		cliOSExit()
-		return
+		return fmt.Errorf("Error restoring backup: %w", err)
 	}
 
-	fmt.Println("== Restoring from database " + source + " on deployment " + backup.DeploymentSlug + " from backup " + backupSlug + " to new deployment " + deploymentName)
-	c.pollNewDeployment(deployment)
+	fmt.Fprintln(c.Out, "== Restoring from database "+source+" on deployment "+backup.DeploymentSlug+" from backup "+backupSlug+" to new deployment "+deploymentName)
+	return c.pollNewDeployment(deployment)
 }
 
-func (c *Controller) CreateBackup(deploymentSlug string) {
-	backup, err := c.Api.BackupDeployment(deploymentSlug)
+func (c *Controller) CreateBackup(deploymentSlug string) error {
+	backup, err := c.Api.BackupDeployment(c.Context, deploymentSlug)
 	if err != nil {
-		fmt.Println("Error triggering backup on deployment: " + err.Error())
-		cliOSExit()
-		return
+		return fmt.Errorf("Error triggering backup on deployment: %w", err)
 	}
 
 	status := backup.Status
-	fmt.Print("Running backup")
+	fmt.Fprint(c.Out, "Running backup")
+	backupId := backup.Id
 	for status == "running" {
-		fmt.Print(".")
-		backup, err = c.Api.GetBackup(backup.Id)
+		fmt.Fprint(c.Out, ".")
+		err = waitToPoll(c.Context)
+		if err == nil {
+			backup, err = c.Api.GetBackup(c.Context, backupId)
+		}
 		if err != nil {
-			fmt.Println(err.Error())
-			fmt.Println("\nError requesting backup status. For a manual update, please run:\n\n mongohq backups:info -b " + backup.Id)
-			cliOSExit()
-			return
+			return fmt.Errorf("\n%w\n\nError requesting backup status. For a manual update, please run:\n\n mongohq backups:info -b %s", err, backupId)
 		}
 		status = backup.Status
 	}
+	fmt.Fprintln(c.Out)
 
 	if status != "complete" {
-		fmt.Println("Error creating backup.  Please try once more, or contact support@mongohq.com.")
-		cliOSExit()
-		return
-	}
-
-	fmt.Println("== Backup " + backup.Filename)
-	fmt.Println(" deployment : " + deploymentSlug)
-	fmt.Println(" databases  : " + strings.Join(backup.DatabaseNames, ", "))
-	fmt.Println(" status     : " + backup.Status)
-	fmt.Println(" created at : " + backup.CreatedAt)
-	fmt.Println(" type       : " + backup.Type)
-	fmt.Println(" size       : " + backup.PrettySize())
+		return errors.New("Error creating backup.  Please try once more, or contact support@mongohq.com.")
+	}
+
+	fmt.Fprintln(c.Out, "== Backup "+backup.Filename)
+	fmt.Fprintln(c.Out, " deployment : "+deploymentSlug)
+	fmt.Fprintln(c.Out, " databases  : "+strings.Join(backup.DatabaseNames, ", "))
+	fmt.Fprintln(c.Out, " status     : "+backup.Status)
+	fmt.Fprintln(c.Out, " created at : "+backup.CreatedAt)
+	fmt.Fprintln(c.Out, " type       : "+backup.Type)
+	fmt.Fprintln(c.Out, " size       : "+backup.PrettySize())
 	if backup.Status == "complete" {
-		fmt.Println(" download   : " + backup.DownloadLink())
+		fmt.Fprintln(c.Out, " download   : "+backup.DownloadLink())
+	}
+	return nil
+}
+
+func backupsTable(backups []mongohq.Backup) table {
+	rows := table{headers: []string{"ID", "FILENAME", "DEPLOYMENT", "DATABASES", "STATUS", "TYPE", "SIZE", "CREATED AT"}}
+	for _, backup := range backups {
+		rows.add(backup.Id, backup.Filename, backup.DeploymentSlug, strings.Join(backup.DatabaseNames, ","), backup.Status, backup.Type, backup.PrettySize(), backup.CreatedAt)
 	}
+	return rows
 }
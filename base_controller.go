@@ -1,14 +1,97 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"os"
-	"regexp"
+	"github.com/MongoHQ/mongohq-cli/mongohq"
+	"io"
 	"strings"
+	"sync"
+	"text/template"
+	"time"
 )
 
+// Controller actions write their output to Out and return errors rather
+// than printing them, leaving the exit code to the caller.  Read commands
+// honour Format and Template; see render.
 type Controller struct {
-	Api *Api
+	Api      *mongohq.Api
+	Context  context.Context
+	Out      io.Writer
+	Err      io.Writer
+	Format   string
+	Template *template.Template
+}
+
+// eachAccount calls fetch for every account concurrently, each with its
+// own copy of the Api pointed at that account, for --all-accounts.  The
+// copies share the Api's bound on requests in flight, however many accounts
+// there are.  fetch is given the account's index, to store its results in
+// order.  Every account is tried; the error reports the ones that failed.
+func (c *Controller) eachAccount(accounts []mongohq.Account, fetch func(i int, api *mongohq.Api) error) error {
+	errs := make([]error, len(accounts))
+
+	var wait sync.WaitGroup
+	for i, account := range accounts {
+		wait.Add(1)
+		go func(i int, api *mongohq.Api) {
+			defer wait.Done()
+			errs[i] = fetch(i, api)
+		}(i, c.Api.ForAccount(account.Slug))
+	}
+	wait.Wait()
+
+	var failed partialError
+	for i, err := range errs {
+		if err != nil {
+			failed.add("Error retrieving account "+accounts[i].Slug+": ", err)
+		}
+	}
+	return failed.err()
+}
+
+// partialError lists what a listing could not read, such as the accounts
+// eachAccount could not reach, while the rest is still shown.  It unwraps
+// to the first failure, which picks the exit code.
+type partialError struct {
+	messages []string
+	first    error
+}
+
+func (e *partialError) add(prefix string, err error) {
+	e.messages = append(e.messages, prefix+err.Error())
+	if e.first == nil {
+		e.first = err
+	}
+}
+
+// err is nil when nothing failed.
+func (e partialError) err() error {
+	if e.first == nil {
+		return nil
+	}
+	return e
+}
+
+func (e partialError) Error() string {
+	return strings.Join(e.messages, "\n")
+}
+
+func (e partialError) Unwrap() error {
+	return e.first
+}
+
+var pollInterval = 2 * time.Second
+
+// waitToPoll pauses between status checks, returning early with the
+// context's error when the command is cancelled.
+func waitToPoll(ctx context.Context) error {
+	select {
+	case <-time.After(pollInterval):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func prompt(text string) string {
@@ -28,35 +111,32 @@ func prompt(text string) string {
 	return response
 }
 
-func formatHostname(host string) string {
-	hostRegex := regexp.MustCompile(".(?:mongohq|mongolayer).com")
-	host = hostRegex.ReplaceAllLiteralString(host, "")
-	return host
-}
-
-func (c *Controller) pollNewDeployment(deployment Deployment) {
+func (c *Controller) pollNewDeployment(deployment mongohq.Deployment) error {
 	var err error
 	status := deployment.Status
+	deploymentName := deployment.Name
 
 	for status == "new" {
-		fmt.Print(".")
-		deployment, err = c.Api.GetDeployment(deployment.Name)
+		fmt.Fprint(c.Out, ".")
+		err = waitToPoll(c.Context)
+		if err == nil {
+			deployment, err = c.Api.GetDeployment(c.Context, deploymentName)
+		}
 		if err != nil {
-			fmt.Println(err.Error())
-			fmt.Println("\nError pulling deployment information.  For a manual update, please run:\n\n mongohq deployment:info --deployment " + deployment.Name)
-			os.Exit(1)
+			return fmt.Errorf("\n%w\n\nError pulling deployment information.  For a manual update, please run:\n\n mongohq deployments:info --deployment %s", err, deploymentName)
 		}
 		status = deployment.Status
 	}
 
-	fmt.Print("\n")
-	fmt.Println("Your database is ready. To add a user to your database, run:")
-	fmt.Println("  mongohq users:create --deployment " + deployment.Name + " --database " + deployment.Databases[0].Name + " -u <username>")
-	fmt.Println("")
-	fmt.Println("To connect to your database, run:")
-	fmt.Println("  mongo " + deployment.CurrentPrimary + "/" + deployment.Databases[0].Name + " -u <username>" + " -p")
-	fmt.Println("")
-	fmt.Println("Your applications should use the following URI to connect:")
-	fmt.Println("  mongodb://<username>:<password>@" + strings.Join(deployment.Members, ",") + "/" + deployment.Databases[0].Name)
-	fmt.Println("\nEnjoy!")
+	fmt.Fprint(c.Out, "\n")
+	fmt.Fprintln(c.Out, "Your database is ready. To add a user to your database, run:")
+	fmt.Fprintln(c.Out, "  mongohq users:create --deployment "+deployment.Name+" --database "+deployment.Databases[0].Name+" -u <username>")
+	fmt.Fprintln(c.Out, "")
+	fmt.Fprintln(c.Out, "To connect to your database, run:")
+	fmt.Fprintln(c.Out, "  mongo "+deployment.CurrentPrimary+"/"+deployment.Databases[0].Name+" -u <username>"+" -p")
+	fmt.Fprintln(c.Out, "")
+	fmt.Fprintln(c.Out, "Your applications should use the following URI to connect:")
+	fmt.Fprintln(c.Out, "  mongodb://<username>:<password>@"+strings.Join(deployment.Members, ",")+"/"+deployment.Databases[0].Name)
+	fmt.Fprintln(c.Out, "\nEnjoy!")
+	return nil
 }
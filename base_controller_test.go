@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"github.com/MongoHQ/mongohq-cli/mongohq"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestAllAccountsBoundsRequests lists deployments across enough accounts,
+// each needing a request per deployment for its details, that requests
+// would pile up without a shared bound.
+func TestAllAccountsBoundsRequests(t *testing.T) {
+	server := newTestServer(t)
+	server.SummaryListings = true
+	for i := 0; i < 20; i++ {
+		slug := fmt.Sprintf("account-%d", i)
+		server.Accounts = append(server.Accounts, mongohq.Account{Id: slug, Name: slug, Slug: slug, Active: true})
+		for j := 0; j < 3; j++ {
+			name := fmt.Sprintf("%s-deployment-%d", slug, j)
+			server.Deployments[slug] = append(server.Deployments[slug],
+				mongohq.Deployment{Id: name, Name: name, Plan: "elastic", Location: "aws:us-east-1", Status: "running", Version: "2.6.3"})
+		}
+	}
+
+	var lock sync.Mutex
+	inFlight, most := 0, 0
+	handler := server.Config.Handler
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		inFlight++
+		if inFlight > most {
+			most = inFlight
+		}
+		lock.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+		handler.ServeHTTP(w, r)
+
+		lock.Lock()
+		inFlight--
+		lock.Unlock()
+	})
+
+	r := runCommand(t, "deployments", "--all-accounts", "--columns", "account,name,plan")
+	if r.status != 0 {
+		t.Fatalf("exited %d: %s", r.status, r.stderr)
+	}
+	if got := strings.Count(r.stdout, "elastic"); got != 61 {
+		t.Errorf("listed %d deployments with their details, want 61:\n%s", got, r.stdout)
+	}
+	if most > cap(apiRequests) {
+		t.Errorf("%d requests were in flight at once, want at most %d", most, cap(apiRequests))
+	}
+}
@@ -1,43 +1,424 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"github.com/MongoHQ/mongohq-cli/mongohq"
 	"github.com/codegangsta/cli"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
 )
 
 func requireArguments(c *cli.Context, argumentsSlice []string, errorMessages []string) error {
-	err := false
+	var missing []string
 
 	for _, argument := range argumentsSlice {
 		if !c.IsSet(argument) {
-			err = true
-			fmt.Println("--" + argument + " is required")
+			missing = append(missing, "--"+argument+" is required")
 		}
 	}
 
-	if err {
+	if len(missing) > 0 {
 		if !replMode {
-			fmt.Println("\nMissing arguments, for more information, run: mongohq " + c.Command.Name + " --help\n")
+			missing = append(missing, "\nMissing arguments, for more information, run: mongohq "+c.Command.Name+" --help\n")
 		} else {
-			fmt.Println("Missing arguments: type 'help " + c.Command.Name + "' for details")
+			missing = append(missing, "Missing arguments: type 'help "+c.Command.Name+"' for details")
 		}
 
-		for _, errorMessage := range errorMessages {
-			fmt.Println(errorMessage)
+		missing = append(missing, errorMessages...)
+		return errors.New(strings.Join(missing, "\n"))
+	}
+	return nil
+}
+
+// quietError carries an exit code for a failure that should not be
+// reported, such as a stream ended with Ctrl-C.
+type quietError struct {
+	error
+}
+
+func (e quietError) Unwrap() error {
+	return e.error
+}
+
+// run turns an action that returns an error into a cli action.  Together
+// with reportError, it is the one place errors are printed and exit codes
+// picked; in the shell, the error is printed and the prompt returns.
+func run(action func(c *cli.Context) error) func(c *cli.Context) {
+	return func(c *cli.Context) {
+		if err := action(c); err != nil {
+			reportError(err)
 		}
+	}
+}
+
+func reportError(err error) {
+	var quiet quietError
+	if !errors.As(err, &quiet) {
+		message := err.Error()
+		if colorErrors {
+			message = "\x1b[31m" + message + "\x1b[0m"
+		}
+		fmt.Fprintln(os.Stderr, message)
+	}
+	cliOSExitWithError(err)
+}
+
+// isInteractive reports whether there is someone at a terminal to answer
+// prompts.
+func isInteractive() bool {
+	return replMode || stdinIsTerminal()
+}
+
+// stdinIsTerminal is a variable so that tests can stand in for a terminal.
+// CI runners usually give a pipe or /dev/null, which is a character device
+// too.
+var stdinIsTerminal = func() bool {
+	stat, err := os.Stdin.Stat()
+	if err != nil || stat.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	if devNull, err := os.Stat(os.DevNull); err == nil && os.SameFile(stat, devNull) {
+		return false
+	}
+	return true
+}
 
-		return fmt.Errorf("Missing arguments")
+// tokenSetting reads --token, falling back to MONGOHQ_API_TOKEN, then
+// MONGOHQ_TOKEN, the name derived from the flag.
+func tokenSetting(c *cli.Context) string {
+	if token := c.GlobalString("token"); token != "" {
+		return token
+	}
+	if token := os.Getenv("MONGOHQ_API_TOKEN"); token != "" {
+		return token
+	}
+	return os.Getenv("MONGOHQ_TOKEN")
+}
+
+// otpSetting reads --otp, falling back to MONGOHQ_OTP.
+func otpSetting(c *cli.Context) string {
+	if otp := c.GlobalString("otp"); otp != "" {
+		return otp
+	}
+	return os.Getenv("MONGOHQ_OTP")
+}
+
+// credentialStoreSetting reads --credential-store, falling back to
+// MONGOHQ_CREDENTIAL_STORE.  Empty means the profile's own store.
+func credentialStoreSetting(c *cli.Context) (string, error) {
+	name := c.GlobalString("credential-store")
+	if name == "" {
+		name = os.Getenv("MONGOHQ_CREDENTIAL_STORE")
+	}
+	if name == "" {
+		return "", nil
+	}
+	_, err := credentialStoreFor(name)
+	return name, err
+}
+
+// requireAllAccounts checks that --all-accounts is not combined with
+// --account or with flags that pick something within one account.
+func requireAllAccounts(c *cli.Context, conflicting ...string) error {
+	if c.GlobalString("account") != "" {
+		return errors.New("--all-accounts cannot be used with --account")
+	}
+	for _, name := range conflicting {
+		if c.IsSet(name) {
+			return errors.New("--all-accounts cannot be used with --" + name)
+		}
+	}
+	return nil
+}
+
+// argumentOrDefault reads a flag naming an existing deployment or
+// database, falling back to the default from config:set.
+func argumentOrDefault(c *cli.Context, name string) string {
+	if c.IsSet(name) {
+		return c.String(name)
+	}
+	// the default database is on the default deployment
+	if name == "database" && c.IsSet("deployment") && c.String("deployment") != configValue("deployment") {
+		return ""
+	}
+	return configValue(name)
+}
+
+// requireArgumentsOrDefaults is requireArguments for flags read with
+// argumentOrDefault.
+func requireArgumentsOrDefaults(c *cli.Context, argumentsSlice []string) error {
+	var missing, hints []string
+	for _, argument := range argumentsSlice {
+		if argumentOrDefault(c, argument) == "" {
+			missing = append(missing, argument)
+			hints = append(hints, "To default --"+argument+", run: mongohq config:set --key "+argument+" --value <"+argument+">")
+		}
+	}
+
+	if len(missing) > 0 {
+		return requireArguments(c, missing, hints)
 	}
 	return nil
 }
 
+// deploymentListing reads the deployments command's columns, sort and
+// filters.
+func deploymentListing(c *cli.Context) DeploymentListing {
+	return DeploymentListing{
+		Columns:   c.String("columns"),
+		Sort:      c.String("sort"),
+		Statuses:  c.String("status"),
+		Plans:     c.String("plan"),
+		Locations: c.String("location"),
+		Versions:  c.String("version"),
+	}
+}
+
+// optionalString returns the value of a flag, or "" when it was not given.
+func optionalString(c *cli.Context, name string) string {
+	if !c.IsSet(name) {
+		return ""
+	}
+	return c.String(name)
+}
+
 func findClosestCommand(context *cli.Context, command string) {
+	aliases := commandAliases()
+
+	// aliases are expanded before the app runs, so one only gets here
+	// through `mongohq help <alias>`
+	if expansion, ok := aliases[command]; ok {
+		fmt.Println("`" + command + "` is an alias for `mongohq " + expansion + "`")
+		return
+	}
+
+	var suggestion string
+	if closest := closestCommand(context.App, command, aliases); closest != "" {
+		suggestion = "Did you mean `" + closest + "`"
+		if expansion, ok := aliases[closest]; ok {
+			suggestion += ", your alias for `" + expansion + "`"
+		}
+		suggestion += "?"
+	}
 
 	if !replMode {
-		fmt.Println(" ! `" + command + "` is not a mongohq command.")
-		fmt.Println(" ! See `mongohq help` for a list of available commands")
+		message := " ! `" + command + "` is not a mongohq command."
+		if suggestion != "" {
+			message += "\n ! " + suggestion
+		}
+		reportError(errors.New(message + "\n ! See `mongohq help` for a list of available commands"))
+	} else if suggestion != "" {
+		reportError(errors.New("Unknown command:" + command + ".  " + suggestion))
+	} else {
+		reportError(errors.New("Unknown command:" + command))
+	}
+}
+
+// printHelpWithAliases adds the user's aliases to the list of commands in
+// `mongohq help`.  It wraps cli.HelpPrinter.
+func printHelpWithAliases(printHelp func(templ string, data interface{})) func(templ string, data interface{}) {
+	return func(templ string, data interface{}) {
+		printHelp(templ, data)
+
+		aliases := userAliases()
+		if templ != cli.AppHelpTemplate || len(aliases) == 0 {
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+		fmt.Fprintln(w, "ALIASES:")
+		for _, alias := range aliases {
+			fmt.Fprintln(w, "   "+alias.Name+"\t"+alias.Command)
+		}
+		w.Flush()
+	}
+}
+
+// profileSetting picks the profile from --profile, then MONGOHQ_PROFILE, then
+// the one chosen with profiles:use.
+func profileSetting(c *cli.Context) (string, error) {
+	name := c.GlobalString("profile")
+	if name == "" {
+		name = os.Getenv("MONGOHQ_PROFILE")
+	}
+	if name == "" {
+		return getSelectedProfile(), nil
+	}
+	return name, validateProfileName(name)
+}
+
+// apiUrlSetting picks the API endpoint from --api-url, then the api-url
+// config key, which covers MONGOHQ_API_URL, the project file and the
+// profile's defaults, then the public API.
+func apiUrlSetting(c *cli.Context) string {
+	if apiUrl := c.GlobalString("api-url"); apiUrl != "" {
+		return apiUrl
+	} else if apiUrl := configValue("api-url"); apiUrl != "" {
+		return apiUrl
+	}
+	return mongohq.DefaultApiUrl
+}
+
+// retryPolicySetting builds the request retry policy from the global retry
+// flags, falling back to MONGOHQ_RETRIES and MONGOHQ_RETRY_BACKOFF.
+func retryPolicySetting(c *cli.Context) (mongohq.RetryPolicy, error) {
+	policy := mongohq.DefaultRetryPolicy
+	policy.RetryNonIdempotent = c.GlobalBool("retry-non-idempotent")
+
+	if retries := c.GlobalInt("retries"); retries > 0 {
+		policy.MaxAttempts = retries
+	} else if retries := os.Getenv("MONGOHQ_RETRIES"); retries != "" {
+		attempts, err := strconv.Atoi(retries)
+		if err != nil || attempts < 1 {
+			return policy, fmt.Errorf("MONGOHQ_RETRIES must be a positive number of attempts")
+		}
+		policy.MaxAttempts = attempts
+	}
+
+	backoff := c.GlobalString("retry-backoff")
+	if backoff == "" {
+		backoff = os.Getenv("MONGOHQ_RETRY_BACKOFF")
+	}
+	if backoff != "" {
+		duration, err := time.ParseDuration(backoff)
+		if err != nil || duration <= 0 {
+			return policy, fmt.Errorf("Retry backoff must be a duration, such as 500ms or 2s")
+		}
+		policy.Backoff = duration
+	}
+
+	return policy, nil
+}
+
+var traceFile *os.File
+
+// tracerSetting returns nil unless tracing was asked for with --verbose,
+// --trace-file or their variables, MONGOHQ_VERBOSE and MONGOHQ_TRACE_FILE,
+// or the older MONGOHQ_DEBUG and MONGOHQ_DEBUG_FILE.  The trace file stays
+// open across commands in the shell.
+func tracerSetting(c *cli.Context) (*mongohq.Tracer, error) {
+	path := c.GlobalString("trace-file")
+	if path == "" {
+		path = os.Getenv("MONGOHQ_TRACE_FILE")
+	}
+	if path == "" {
+		path = os.Getenv("MONGOHQ_DEBUG_FILE")
+	}
+
+	if path != "" {
+		if traceFile == nil || traceFile.Name() != path {
+			file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+			if err != nil {
+				return nil, fmt.Errorf("Error opening trace file %s: %s", path, err.Error())
+			}
+			if traceFile != nil {
+				traceFile.Close()
+			}
+			traceFile = file
+		}
+		return mongohq.NewTracer(traceFile), nil
+	}
+
+	verbose := c.GlobalBool("verbose")
+	if value := os.Getenv("MONGOHQ_VERBOSE"); value != "" && !verbose {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, errors.New("MONGOHQ_VERBOSE must be true or false")
+		}
+		verbose = enabled
+	}
+
+	debug := os.Getenv("MONGOHQ_DEBUG")
+	if verbose || (debug != "" && debug != "0" && debug != "false") {
+		return mongohq.NewTracer(os.Stderr), nil
+	}
+	return nil, nil
+}
+
+// timeoutSetting reads --timeout, falling back to the timeout config key,
+// which covers MONGOHQ_TIMEOUT, the project file and the profile's
+// defaults.  Zero means the command may run until it finishes or is
+// interrupted.
+func timeoutSetting(c *cli.Context) (time.Duration, error) {
+	timeout := c.GlobalString("timeout")
+	if timeout == "" {
+		timeout = configValue("timeout")
+	}
+	if timeout == "" {
+		return 0, nil
+	}
+
+	duration, err := time.ParseDuration(timeout)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("Timeout must be a duration, such as 30s or 5m")
+	}
+	return duration, nil
+}
+
+var commandLock sync.Mutex
+var cancelCommand context.CancelFunc
+
+// startCommand gives each command, including each line typed in the shell,
+// its own context.  It is cancelled by Ctrl-C, by the timeout, or when the
+// next command starts.
+func startCommand(timeout time.Duration) context.Context {
+	commandLock.Lock()
+	defer commandLock.Unlock()
+
+	if cancelCommand != nil {
+		cancelCommand()
+	}
+
+	var ctx context.Context
+	if timeout > 0 {
+		ctx, cancelCommand = context.WithTimeout(context.Background(), timeout)
 	} else {
-		fmt.Println("Unknown command:" + command)
+		ctx, cancelCommand = context.WithCancel(context.Background())
+	}
+	return ctx
+}
+
+func finishCommand() {
+	commandLock.Lock()
+	defer commandLock.Unlock()
+
+	if cancelCommand != nil {
+		cancelCommand()
+		cancelCommand = nil
 	}
-	cliOSExit()
+}
+
+// handleInterrupts turns the first Ctrl-C into a cancellation of the running
+// command, so in-flight requests and websocket reads stop cleanly and the
+// shell returns to its prompt.  A Ctrl-C with nothing left to cancel exits.
+func handleInterrupts() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+
+	go func() {
+		for range signals {
+			commandLock.Lock()
+			cancel := cancelCommand
+			cancelCommand = nil
+			commandLock.Unlock()
+
+			if cancel != nil {
+				cancel()
+				continue
+			}
+
+			if replMode {
+				closeTerm()
+				fmt.Println("Quitting shell")
+			}
+			os.Exit(exitInterrupted)
+		}
+	}()
 }
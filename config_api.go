@@ -2,36 +2,353 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"regexp"
+	"sort"
+	"strings"
 )
 
-var configFile = configPath + "/defaults"
+var configFile string
+
+// Each profile has its own credentials and defaults.  The default profile
+// keeps its files directly in configPath, where they were before there
+// were profiles, so existing logins carry on working; the others live
+// under profiles/<name>.  profileFile records the profile
+// chosen with profiles:use.
+const defaultProfile = "default"
+
+var activeProfile = defaultProfile
+var profileFile string
+
+var profileNameRegex = regexp.MustCompile("^[A-Za-z0-9_-]+$")
+
+func validateProfileName(name string) error {
+	if !profileNameRegex.MatchString(name) {
+		return errors.New("Profile names may only contain letters, numbers, dashes and underscores.")
+	}
+	return nil
+}
+
+func profilePath(name string) string {
+	if name == defaultProfile {
+		return configPath
+	}
+	return configPath + "/profiles/" + name
+}
+
+// useProfile points the credential and defaults files at a profile.
+func useProfile(name string) {
+	activeProfile = name
+	credentialFile = profilePath(name) + "/credentials"
+	configFile = profilePath(name) + "/defaults"
+}
+
+func getSelectedProfile() string {
+	name, err := ioutil.ReadFile(profileFile)
+	if err != nil || validateProfileName(strings.TrimSpace(string(name))) != nil {
+		return defaultProfile
+	}
+	return strings.TrimSpace(string(name))
+}
+
+func setSelectedProfile(name string) error {
+	if name == defaultProfile {
+		if err := os.Remove(profileFile); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	return writeFileAtomic(profileFile, []byte(name+"\n"), 0600)
+}
+
+// profileNames lists the default profile, every profile with a directory,
+// and the active profile, which may not have logged in yet.
+func profileNames() []string {
+	names := []string{defaultProfile}
+	if activeProfile != defaultProfile {
+		names = append(names, activeProfile)
+	}
+
+	entries, _ := ioutil.ReadDir(configPath + "/profiles")
+	for _, entry := range entries {
+		if entry.IsDir() && entry.Name() != defaultProfile && entry.Name() != activeProfile && validateProfileName(entry.Name()) == nil {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names[1:])
+	return names
+}
 
 type Config struct {
-	AccountSlug    string `json:"account-slug"`
-	DeploymentSlug string `json:"deployment-slug"`
+	// Version is the layout of the file; see configMigrations.
+	Version int `json:"version"`
+
+	AccountSlug    string `json:"account-slug,omitempty"`
+	DeploymentSlug string `json:"deployment-slug,omitempty"`
+	DatabaseName   string `json:"database-name,omitempty"`
+	ApiUrl         string `json:"api-url,omitempty"`
+	Format         string `json:"format,omitempty"`
+	Color          string `json:"color,omitempty"`
+	Timeout        string `json:"timeout,omitempty"`
+
+	// Where the profile's token is kept, and who it belongs to, which is
+	// not secret.
+	CredentialStore string `json:"credential-store,omitempty"`
+	Email           string `json:"email,omitempty"`
+
+	// Login is how the profile logs in: empty for email and password, or
+	// "web" or "device".
+	Login string `json:"login,omitempty"`
+
+	// Aliases are only kept in the default profile's defaults; see
+	// aliasFile.
+	Aliases map[string]string `json:"aliases,omitempty"`
+}
+
+// configKey is a setting managed with config:get, config:set and
+// config:unset.  field points at where it is kept in a Config.
+type configKey struct {
+	Name  string
+	Usage string
+	field func(*Config) *string
+}
+
+var configKeys = []configKey{
+	{"account", "default account slug", func(c *Config) *string { return &c.AccountSlug }},
+	{"deployment", "default deployment for --deployment", func(c *Config) *string { return &c.DeploymentSlug }},
+	{"database", "default database for --database, on the default deployment", func(c *Config) *string { return &c.DatabaseName }},
+	{"format", "default for --format: text, json, yaml or table", func(c *Config) *string { return &c.Format }},
+	{"api-url", "MongoHQ API endpoint", func(c *Config) *string { return &c.ApiUrl }},
+	{"color", "color error messages: auto, always or never", func(c *Config) *string { return &c.Color }},
+	{"timeout", "default for --timeout, such as 30s or 5m", func(c *Config) *string { return &c.Timeout }},
+}
+
+func lookupConfigKey(name string) (configKey, error) {
+	for _, key := range configKeys {
+		if key.Name == name {
+			return key, nil
+		}
+	}
+
+	var names []string
+	for _, key := range configKeys {
+		names = append(names, key.Name)
+	}
+	return configKey{}, errors.New("Unknown config key " + name + ".  Keys are " + strings.Join(names, ", ") + ".")
+}
+
+// configLayer is one source of config values.  origin names it for
+// config:list --show-origin.
+type configLayer struct {
+	origin string
+	value  func(name string) string
+}
+
+// configLayers are the sources of config values, highest precedence
+// first: MONGOHQ_* variables, the project file, then the profile's
+// defaults.  Flags, where a command has them, come before all three.
+func configLayers() []configLayer {
+	layers := []configLayer{{"$MONGOHQ_*", func(name string) string { return os.Getenv(environmentName(name)) }}}
+
+	if projectConfig != nil {
+		layers = append(layers, configLayer{projectConfig.Path, func(name string) string { return projectConfig.Settings[name] }})
+	}
+
+	config := getConfig()
+	layers = append(layers, configLayer{configFile, func(name string) string {
+		if key, err := lookupConfigKey(name); err == nil {
+			return *key.field(config)
+		}
+		return ""
+	}})
+	return layers
 }
 
+// configSetting is the effective value of a config key and where it came
+// from.  origin is empty when the key is not set.
+func configSetting(name string) (value, origin string) {
+	layers := configLayers()
+	for i, layer := range layers {
+		value := layer.value(name)
+		if value == "" {
+			continue
+		}
+
+		// the default database belongs to the default deployment beside
+		// it, so it is dropped when a higher layer picks another deployment
+		if name == "database" {
+			for _, higher := range layers[:i] {
+				if deployment := higher.value("deployment"); deployment != "" && deployment != layer.value("deployment") {
+					return "", ""
+				}
+			}
+		}
+
+		if layer.origin == "$MONGOHQ_*" {
+			return value, "$" + environmentName(name)
+		}
+		return value, layer.origin
+	}
+	return "", ""
+}
+
+func configValue(name string) string {
+	value, _ := configSetting(name)
+	return value
+}
+
+// configKeysHelp lists the keys for command help.
+func configKeysHelp() string {
+	var lines []string
+	for _, key := range configKeys {
+		lines = append(lines, key.Name+strings.Repeat(" ", 12-len(key.Name))+key.Usage)
+	}
+	return strings.Join(lines, "\n  ")
+}
+
+// configVersion is the version of the defaults file this release writes.
+// configMigrations[i] upgrades a file from version i to i+1, so older
+// files are brought up to date when they are read.  Files from before
+// there were versions are version 0.
+const configVersion = 1
+
+var configMigrations = []func(values map[string]interface{}){
+	// version 1 leaves out the account and deployment when they are unset
+	func(values map[string]interface{}) {
+		for _, key := range []string{"account-slug", "deployment-slug"} {
+			if values[key] == "" {
+				delete(values, key)
+			}
+		}
+	},
+}
+
+// getConfig is the profile's defaults.  A file that cannot be read is
+// reported by setupCommand, so here it reads as empty.
 func getConfig() *Config {
-	if _, err := os.Stat(configFile); os.IsNotExist(err) {
-		return new(Config)
-	} else {
-		var config *Config
+	return readConfig(configFile)
+}
 
-		jsonText, err := ioutil.ReadFile(configFile)
+func readConfig(path string) *Config {
+	config, err := loadConfig(path)
+	if err != nil {
+		return &Config{Version: configVersion}
+	}
+	return config
+}
+
+// loadConfig reads a defaults file, migrating it from an earlier version.
+// It is empty when the file does not exist yet.
+func loadConfig(path string) (*Config, error) {
+	jsonText, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Config{Version: configVersion}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Error reading %s: %w", path, err)
+	}
+	repairPermissions(path, 0600)
+
+	var values map[string]interface{}
+	if err := json.Unmarshal(jsonText, &values); err != nil || values == nil {
+		return nil, errors.New("Error reading " + path + ": it is not a JSON object.  Fix the file, or remove it to start again.")
+	}
 
-		if err != nil {
-			return new(Config)
+	version := 0
+	if value, ok := values["version"]; ok {
+		number, ok := value.(float64)
+		if !ok || number < 0 || number != float64(int(number)) {
+			return nil, errors.New("Error reading " + path + ": version must be a whole number.")
 		}
+		version = int(number)
+	}
+	if version > configVersion {
+		return nil, fmt.Errorf("%s was written by a newer release of mongohq (version %d, where this one knows up to %d).  Run `mongohq update` to upgrade.", path, version, configVersion)
+	}
+
+	for ; version < configVersion; version++ {
+		configMigrations[version](values)
+	}
+	values["version"] = configVersion
+
+	migrated, _ := json.Marshal(values)
+	config := new(Config)
+	if err := json.Unmarshal(migrated, config); err != nil {
+		return nil, fmt.Errorf("Error reading %s: %s.  Fix the file, or remove it to start again.", path, err.Error())
+	}
+	return config, nil
+}
+
+// updateConfig changes the profile's defaults.  See updateConfigFile.
+func updateConfig(change func(config *Config) error) error {
+	return updateConfigFile(configFile, change)
+}
 
-		_ = json.Unmarshal(jsonText, &config)
+// updateConfigFile reads a defaults file, changes it and writes it back,
+// holding its lock throughout so that a change made by another mongohq
+// command at the same time is not lost.  Nothing is written when change
+// returns an error.
+func updateConfigFile(path string, change func(config *Config) error) error {
+	unlock, err := lockFile(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
-		return config
+	config, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+	if err := change(config); err != nil {
+		return err
 	}
+
+	config.Version = configVersion
+	jsonText, _ := json.Marshal(config)
+	return writeFileAtomic(path, jsonText, 0600)
 }
 
-func (d *Config) Save() error {
-	jsonText, _ := json.Marshal(d)
-	return ioutil.WriteFile(configFile, jsonText, 0600)
+// Aliases are shared by every profile, and have to be known before the
+// command line is parsed to pick one, so they are kept in the default
+// profile's defaults whichever profile is active.
+var aliasFile string
+
+// Alias is a user-defined command name.  Origin is the file defining it.
+type Alias struct {
+	Name    string `json:"name"`
+	Command string `json:"command"`
+	Origin  string `json:"origin"`
+}
+
+// userAliases lists the aliases from aliases:set, then the project file's,
+// which win over those of the same name, sorted by name.
+func userAliases() []Alias {
+	byName := map[string]Alias{}
+	for name, command := range readConfig(aliasFile).Aliases {
+		byName[name] = Alias{name, command, aliasFile}
+	}
+	if project, err := findProjectConfig(); err == nil && project != nil {
+		for name, command := range project.Aliases {
+			byName[name] = Alias{name, command, project.Path}
+		}
+	}
+
+	var aliases []Alias
+	for _, alias := range byName {
+		aliases = append(aliases, alias)
+	}
+	sort.Slice(aliases, func(i, j int) bool { return aliases[i].Name < aliases[j].Name })
+	return aliases
+}
+
+// commandAliases maps each alias to the command line it stands for.
+func commandAliases() map[string]string {
+	aliases := map[string]string{}
+	for _, alias := range userAliases() {
+		aliases[alias.Name] = alias.Command
+	}
+	return aliases
 }
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestUpdateConfigFileConcurrently(t *testing.T) {
+	isolate(t)
+	path := filepath.Join(configPath, "shared")
+
+	const writers = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- updateConfigFile(path, func(config *Config) error {
+				if config.Aliases == nil {
+					config.Aliases = map[string]string{}
+				}
+				config.Aliases["alias"+strconv.Itoa(i)] = "deployments"
+				return nil
+			})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Aliases) != writers {
+		t.Errorf("%d of %d writes were kept: %v", len(config.Aliases), writers, config.Aliases)
+	}
+
+	// the temporary files are renamed into place or removed
+	entries, err := ioutil.ReadDir(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), ".tmp") {
+			t.Errorf("left %s behind", entry.Name())
+		}
+	}
+}
+
+func TestUpdateConfigFileChangeFails(t *testing.T) {
+	isolate(t)
+	path := filepath.Join(configPath, "defaults")
+	if err := ioutil.WriteFile(path, []byte(`{"version":1,"format":"json"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	refused := errors.New("refused")
+	err := updateConfigFile(path, func(config *Config) error {
+		config.Format = "yaml"
+		return refused
+	})
+	if err != refused {
+		t.Fatalf("got %v, want the change's error", err)
+	}
+	if config, _ := loadConfig(path); config.Format != "json" {
+		t.Errorf("format is %q after a failed change, want it untouched", config.Format)
+	}
+}
+
+var loadConfigTests = []struct {
+	name string
+	text string
+	want Config
+	err  string
+}{
+	{
+		name: "version 0",
+		text: `{"account-slug":"","deployment-slug":"","database-name":"orders","format":"json"}`,
+		want: Config{Version: configVersion, DatabaseName: "orders", Format: "json"},
+	},
+	{
+		name: "current version",
+		text: `{"version":1,"account-slug":"test-account","aliases":{"ls":"deployments"}}`,
+		want: Config{Version: configVersion, AccountSlug: "test-account", Aliases: map[string]string{"ls": "deployments"}},
+	},
+	{
+		name: "newer version",
+		text: `{"version":2,"account-slug":"test-account"}`,
+		err:  "was written by a newer release of mongohq (version 2, where this one knows up to 1).  Run `mongohq update` to upgrade.",
+	},
+	{
+		name: "fractional version",
+		text: `{"version":1.5}`,
+		err:  "version must be a whole number.",
+	},
+	{
+		name: "not an object",
+		text: `["account-slug"]`,
+		err:  "it is not a JSON object.",
+	},
+	{
+		name: "truncated",
+		text: `{"account-slug":"test-`,
+		err:  "it is not a JSON object.",
+	},
+}
+
+func TestLoadConfig(t *testing.T) {
+	for _, test := range loadConfigTests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "defaults")
+			if err := ioutil.WriteFile(path, []byte(test.text), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			config, err := loadConfig(path)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want one containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*config, test.want) {
+				t.Errorf("got %+v, want %+v", *config, test.want)
+			}
+		})
+	}
+}
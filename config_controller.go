@@ -1,78 +1,257 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	"os"
+	"github.com/MongoHQ/mongohq-cli/mongohq"
+	"strings"
+	"time"
 )
 
-func (c *Controller) SetConfigAccount(slug string) {
-	account, err := c.Api.GetAccount(slug)
+// ConfigSetting is one key from config:list.  Origin, with --show-origin,
+// is the file the value came from.
+type ConfigSetting struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Origin string `json:"origin,omitempty"`
+}
+
+// ListConfig shows the effective settings, with the project file's over
+// the profile's defaults, then the aliases.
+func (c *Controller) ListConfig(showOrigin bool) error {
+	var settings []ConfigSetting
+	for _, key := range configKeys {
+		value, origin := configSetting(key.Name)
+		settings = append(settings, ConfigSetting{Key: key.Name, Value: value, Origin: origin})
+	}
+
+	for _, alias := range userAliases() {
+		settings = append(settings, ConfigSetting{Key: "alias." + alias.Name, Value: alias.Command, Origin: alias.Origin})
+	}
 
+	if !showOrigin {
+		for i := range settings {
+			settings[i].Origin = ""
+		}
+	}
+
+	if c.Format != formatText {
+		rows := table{headers: []string{"KEY", "VALUE"}}
+		if showOrigin {
+			rows.headers = append(rows.headers, "ORIGIN")
+		}
+		for _, setting := range settings {
+			if showOrigin {
+				rows.add(setting.Key, setting.Value, setting.Origin)
+			} else {
+				rows.add(setting.Key, setting.Value)
+			}
+		}
+		return c.render(settings, rows)
+	}
+
+	width := 0
+	for _, setting := range settings {
+		if len(setting.Key) > width {
+			width = len(setting.Key)
+		}
+	}
+
+	fmt.Fprintln(c.Out, "== Config")
+	for _, setting := range settings {
+		line := " " + setting.Key + strings.Repeat(" ", width-len(setting.Key)) + " : " + setting.Value
+		if setting.Origin != "" {
+			line += "  (" + setting.Origin + ")"
+		}
+		fmt.Fprintln(c.Out, line)
+	}
+	return nil
+}
+
+// GetConfig prints the effective value of a key, or nothing when it is not
+// set.
+func (c *Controller) GetConfig(name string) error {
+	key, err := lookupConfigKey(name)
 	if err != nil {
-		fmt.Println("Error accessing account:" + err.Error())
-		cliOSExit()
-		return
+		return err
+	}
+
+	fmt.Fprintln(c.Out, configValue(key.Name))
+	return nil
+}
+
+// SetConfig checks a value before saving it: accounts, deployments and
+// databases must exist, and the rest must parse.
+func (c *Controller) SetConfig(name, value string) error {
+	key, err := lookupConfigKey(name)
+	if err != nil {
+		return err
 	}
 
 	config := getConfig()
-	config.AccountSlug = account.Slug
+	switch key.Name {
+	case "account":
+		return c.SetConfigAccount(value)
+	case "api-url":
+		return c.SetConfigApiUrl(value)
+	case "deployment":
+		deployment, err := c.Api.GetDeployment(c.Context, value)
+		if err != nil {
+			return fmt.Errorf("Error accessing deployment: %w", err)
+		}
+		value = deployment.NameOrId()
+	case "database":
+		if config.DeploymentSlug == "" {
+			return errors.New("A default database needs a default deployment.  Set one first with config:set --key deployment --value <deployment>.")
+		}
+		database, err := c.Api.GetDatabase(c.Context, config.DeploymentSlug, value)
+		if err != nil {
+			return fmt.Errorf("Error accessing database %s on deployment %s: %w", value, config.DeploymentSlug, err)
+		}
+		value = database.Name
+	case "format":
+		if _, _, err := formatSetting(value, ""); err != nil {
+			return err
+		}
+	case "color":
+		if _, err := colorSetting(value); err != nil {
+			return err
+		}
+	case "timeout":
+		if duration, err := time.ParseDuration(value); err != nil || duration < 0 {
+			return errors.New("Timeout must be a duration, such as 30s or 5m")
+		}
+	}
 
-	if err := config.Save(); err != nil {
-		fmt.Println("Error setting default account: " + err.Error())
-		os.Exit(1)
+	err = updateConfig(func(config *Config) error {
+		// the default database belongs to the old deployment
+		if key.Name == "deployment" && config.DeploymentSlug != value && config.DatabaseName != "" {
+			fmt.Fprintln(c.Out, "Unset default database "+config.DatabaseName+", which was on deployment "+config.DeploymentSlug)
+			config.DatabaseName = ""
+		}
+		*key.field(config) = value
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Error setting %s: %w", key.Name, err)
 	}
 
-	fmt.Println("Set default account to " + account.Slug)
+	fmt.Fprintln(c.Out, "Set "+key.Name+" to "+value)
+	return nil
 }
 
-func requireAccount(api *Api) {
-	runCount := 0
-	for api.Config.AccountSlug == "" {
-		if runCount > 2 {
-			fmt.Println("Default account is required.  Please run `mongohq accounts` and `mongohq config:account -a <account-slug>` to set a default acount.")
-			os.Exit(1)
+func (c *Controller) UnsetConfig(name string) error {
+	key, err := lookupConfigKey(name)
+	if err != nil {
+		return err
+	}
+
+	err = updateConfig(func(config *Config) error {
+		*key.field(config) = ""
+		if key.Name == "deployment" {
+			config.DatabaseName = ""
 		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Error unsetting %s: %w", key.Name, err)
+	}
 
-		accounts, err := api.GetAccounts()
+	fmt.Fprintln(c.Out, "Unset "+key.Name)
+	return nil
+}
 
-		if err != nil {
-			fmt.Println("Error returning list of accounts let's try one more time.")
-			runCount += 1
-			continue
-		}
+func (c *Controller) SetConfigAccount(slug string) error {
+	account, err := c.Api.GetAccount(c.Context, slug)
 
-		var account Account
+	if err != nil {
+		return fmt.Errorf("Error accessing account:%w", err)
+	}
 
-		if len(accounts) > 1 {
-			fmt.Println("To continue, we need to set a default account.  Here is a list of accounts you have access to:")
-			for _, account := range accounts {
-				fmt.Println("  " + account.Slug)
-			}
+	err = updateConfig(func(config *Config) error {
+		config.AccountSlug = account.Slug
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Error setting default account: %w", err)
+	}
 
-			accountSlug := prompt("Which account should be default")
-			account, err = api.GetAccount(accountSlug)
+	fmt.Fprintln(c.Out, "Set default account to "+account.Slug)
+	return nil
+}
 
-			if err != nil {
-				fmt.Println("Error accessing the account '" + accountSlug + "'.  Please try again.")
-				runCount += 1
-				continue
-			}
+func (c *Controller) SetConfigApiUrl(apiUrl string) error {
+	if err := mongohq.ValidateApiUrl(apiUrl); err != nil {
+		return err
+	}
 
+	err := updateConfig(func(config *Config) error {
+		if apiUrl == mongohq.DefaultApiUrl {
+			config.ApiUrl = ""
 		} else {
-			account = accounts[0]
+			config.ApiUrl = apiUrl
 		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Error setting API url: %w", err)
+	}
 
-		config := getConfig()
-		config.AccountSlug = account.Slug
-		err = config.Save()
+	fmt.Fprintln(c.Out, "Set API url to "+apiUrl)
+	return nil
+}
 
-		api.Config = config
+// RequireAccount makes sure an account is selected, asking the user to pick a
+// default when they have access to more than one.  Its notices and prompt
+// go to Err, leaving Out to the command's own output.
+func (c *Controller) RequireAccount() error {
+	if c.Api.AccountSlug != "" {
+		return nil
+	}
 
-		if err != nil {
-			fmt.Println("Error saving default configuartion to ~/.mongohq/defaults. Will you check the permissions on the file allow you to write?")
+	accounts, err := c.Api.GetAccounts(c.Context)
+	if err != nil {
+		return fmt.Errorf("Error retrieving accounts: %w", err)
+	}
+
+	var account mongohq.Account
+	if len(accounts) == 0 {
+		return errors.New("You do not have access to any accounts.  Create one from the MongoHQ UI, or ask to be added to one.")
+	} else if len(accounts) > 1 && !isInteractive() {
+		return errors.New("Default account is required.  Please run `mongohq config:account -a <account-slug>` to set a default account.")
+	} else if len(accounts) > 1 {
+		fmt.Fprintln(c.Err, "To continue, we need to set a default account.  Here is a list of accounts you have access to:")
+		for _, account := range accounts {
+			fmt.Fprintln(c.Err, "  "+account.Slug)
+		}
+
+		for account.Slug == "" {
+			accountSlug := prompt("Which account should be default")
+			if accountSlug == "" {
+				return errors.New("Default account is required.  Please run `mongohq config:account -a <account-slug>` to set a default account.")
+			}
+			for _, listed := range accounts {
+				if listed.Slug == accountSlug {
+					account = listed
+				}
+			}
+			if account.Slug == "" {
+				fmt.Fprintln(c.Err, "There is no account '"+accountSlug+"' in the list.  Please try again.")
+			}
 		}
+	} else {
+		account = accounts[0]
+	}
 
-		fmt.Println("Set default account to " + account.Slug + "\n")
-		return
+	c.Api.AccountSlug = account.Slug
+	err = updateConfig(func(config *Config) error {
+		config.AccountSlug = account.Slug
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintln(c.Err, "Error saving default configuration to "+configFile+": "+err.Error())
 	}
+
+	fmt.Fprintln(c.Err, "Set default account to "+account.Slug+"\n")
+	return nil
 }
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+)
+
+// credentialStore keeps the OAuth token for each profile.  The store a
+// profile uses is recorded in its defaults, as credential-store.
+type credentialStore interface {
+	Load(profile string) (credentials, error)
+	Save(profile string, creds credentials) error
+	Delete(profile string) error
+}
+
+type credentials struct {
+	Email      string `json:"email"`
+	OauthToken string `json:"oauth_token"`
+}
+
+const (
+	storeSecretService = "secret-service"
+	storeEncryptedFile = "encrypted-file"
+	storePlaintext     = "plaintext"
+)
+
+// errNoCredentials means the profile has not logged in, as opposed to its
+// credentials being unreadable.
+var errNoCredentials = errors.New("No stored credentials.")
+
+// credentialStores are the stores by the names profiles record them under.
+var credentialStores = map[string]credentialStore{
+	storeSecretService: secretServiceStore{},
+	storeEncryptedFile: encryptedFileStore{},
+	storePlaintext:     plaintextStore{},
+}
+
+func credentialStoreFor(name string) (credentialStore, error) {
+	if store, ok := credentialStores[name]; ok {
+		return store, nil
+	}
+	return nil, errors.New("Credential store must be one of secret-service, encrypted-file or plaintext")
+}
+
+// defaultCredentialStore is used for new logins when no store was chosen:
+// the Secret Service where there is one, otherwise an encrypted file.
+// Plaintext is only ever used when asked for.
+func defaultCredentialStore() string {
+	if secretServiceAvailable() {
+		return storeSecretService
+	}
+	return storeEncryptedFile
+}
+
+// savedCredentialStore is the store a profile's credentials are in.
+// Profiles from before stores could be chosen have a plaintext credentials
+// file, which carries on working until it is moved with
+// credentials:migrate.
+func savedCredentialStore() string {
+	if store := getConfig().CredentialStore; store != "" {
+		return store
+	}
+	if _, err := os.Stat(credentialFile); err == nil {
+		return storePlaintext
+	}
+	return defaultCredentialStore()
+}
+
+// plaintextStore is the original credentials file: JSON, readable only by
+// the user.
+type plaintextStore struct{}
+
+func (plaintextStore) path(profile string) string {
+	return profilePath(profile) + "/credentials"
+}
+
+func (s plaintextStore) Load(profile string) (credentials, error) {
+	var creds credentials
+
+	jsonText, err := ioutil.ReadFile(s.path(profile))
+	if os.IsNotExist(err) {
+		return creds, errNoCredentials
+	} else if err != nil {
+		return creds, err
+	}
+	repairPermissions(s.path(profile), 0600)
+
+	if err := json.Unmarshal(jsonText, &creds); err != nil || creds.OauthToken == "" {
+		return creds, errNoCredentials
+	}
+	return creds, nil
+}
+
+func (s plaintextStore) Save(profile string, creds credentials) error {
+	jsonText, _ := json.Marshal(creds)
+
+	unlock, err := lockFile(s.path(profile))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := writeFileAtomic(s.path(profile), jsonText, 0600); err != nil {
+		return errors.New("Error writing credentials to " + s.path(profile))
+	}
+	return nil
+}
+
+func (s plaintextStore) Delete(profile string) error {
+	if err := os.Remove(s.path(profile)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
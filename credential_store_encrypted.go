@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"golang.org/x/crypto/pbkdf2"
+	"io/ioutil"
+	"os"
+)
+
+// encryptedFileStore keeps credentials in a file sealed with AES-256-GCM,
+// under a key derived from a passphrase with PBKDF2-HMAC-SHA256.  The
+// passphrase comes from MONGOHQ_CREDENTIAL_PASSPHRASE, or is asked for once
+// per process.
+type encryptedFileStore struct{}
+
+type encryptedCredentials struct {
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+const passphraseIterations = 600000
+
+var credentialPassphrase string
+
+func (encryptedFileStore) path(profile string) string {
+	return profilePath(profile) + "/credentials.enc"
+}
+
+func (s encryptedFileStore) Load(profile string) (credentials, error) {
+	var creds credentials
+
+	jsonText, err := ioutil.ReadFile(s.path(profile))
+	if os.IsNotExist(err) {
+		return creds, errNoCredentials
+	} else if err != nil {
+		return creds, err
+	}
+	repairPermissions(s.path(profile), 0600)
+
+	var sealed encryptedCredentials
+	if err := json.Unmarshal(jsonText, &sealed); err != nil {
+		return creds, errors.New("Error reading encrypted credentials from " + s.path(profile))
+	}
+
+	passphrase, err := readPassphrase(false)
+	if err != nil {
+		return creds, err
+	}
+
+	gcm, err := passphraseCipher(passphrase, sealed.Salt, sealed.Iterations)
+	if err != nil {
+		return creds, err
+	}
+
+	plaintext, err := gcm.Open(nil, sealed.Nonce, sealed.Ciphertext, nil)
+	if err != nil {
+		credentialPassphrase = ""
+		return creds, errors.New("Incorrect passphrase for the stored credentials.")
+	}
+
+	err = json.Unmarshal(plaintext, &creds)
+	return creds, err
+}
+
+func (s encryptedFileStore) Save(profile string, creds credentials) error {
+	passphrase, err := readPassphrase(true)
+	if err != nil {
+		return err
+	}
+
+	sealed := encryptedCredentials{Iterations: passphraseIterations, Salt: make([]byte, 16)}
+	if _, err := rand.Read(sealed.Salt); err != nil {
+		return err
+	}
+
+	gcm, err := passphraseCipher(passphrase, sealed.Salt, sealed.Iterations)
+	if err != nil {
+		return err
+	}
+
+	sealed.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(sealed.Nonce); err != nil {
+		return err
+	}
+
+	plaintext, _ := json.Marshal(creds)
+	sealed.Ciphertext = gcm.Seal(nil, sealed.Nonce, plaintext, nil)
+
+	jsonText, _ := json.Marshal(sealed)
+
+	unlock, err := lockFile(s.path(profile))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := writeFileAtomic(s.path(profile), jsonText, 0600); err != nil {
+		return errors.New("Error writing credentials to " + s.path(profile))
+	}
+	return nil
+}
+
+func (s encryptedFileStore) Delete(profile string) error {
+	if err := os.Remove(s.path(profile)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// readPassphrase asks for the passphrase, twice when it is being set.
+func readPassphrase(confirm bool) (string, error) {
+	if credentialPassphrase != "" {
+		return credentialPassphrase, nil
+	}
+	if passphrase := os.Getenv("MONGOHQ_CREDENTIAL_PASSPHRASE"); passphrase != "" {
+		return passphrase, nil
+	}
+	if !isInteractive() {
+		return "", errors.New("The stored credentials are encrypted.  Set MONGOHQ_CREDENTIAL_PASSPHRASE to use them without a terminal.")
+	}
+
+	passphrase, err := safeGetPass("Passphrase for stored MongoHQ credentials (typing will be hidden): ")
+	if err != nil {
+		return "", errors.New("Error returning passphrase.")
+	}
+	if passphrase == "" {
+		return "", errors.New("A passphrase is required to encrypt stored credentials.")
+	}
+
+	if confirm {
+		confirmed, _ := safeGetPass("Confirm passphrase: ")
+		if passphrase != confirmed {
+			return "", errors.New("Passphrase confirmation failed.")
+		}
+	}
+
+	credentialPassphrase = passphrase
+	return passphrase, nil
+}
+
+func passphraseCipher(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	if iterations < 1 || len(salt) == 0 {
+		return nil, errors.New("Encrypted credentials are missing their key parameters.")
+	}
+
+	block, err := aes.NewCipher(passphraseKey(passphrase, salt, iterations))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// passphraseKey derives the AES-256 key with PBKDF2 (RFC 8018) over
+// HMAC-SHA256.
+func passphraseKey(passphrase string, salt []byte, iterations int) []byte {
+	return pbkdf2.Key([]byte(passphrase), salt, iterations, 32, sha256.New)
+}
@@ -0,0 +1,83 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// secretServiceStore keeps credentials in the freedesktop Secret Service,
+// such as GNOME Keyring or KWallet, talking D-Bus through libsecret's
+// secret-tool.  That binary is a runtime dependency; without it, or without
+// a session bus, the store reports itself unavailable and new logins use
+// the encrypted file.
+type secretServiceStore struct{}
+
+const secretServiceName = "mongohq-cli"
+
+var errSecretServiceUnavailable = errors.New("The secret-service credential store needs secret-tool (from libsecret) and a D-Bus session.")
+
+func secretServiceAvailable() bool {
+	if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		return false
+	}
+	_, err := exec.LookPath("secret-tool")
+	return err == nil
+}
+
+func (secretServiceStore) Load(profile string) (credentials, error) {
+	var creds credentials
+	if !secretServiceAvailable() {
+		return creds, errSecretServiceUnavailable
+	}
+
+	var stderr bytes.Buffer
+	command := exec.Command("secret-tool", "lookup", "service", secretServiceName, "profile", profile)
+	command.Stderr = &stderr
+	output, err := command.Output()
+
+	// lookup fails quietly when there is no such secret
+	if err != nil && stderr.Len() == 0 {
+		return creds, errNoCredentials
+	} else if err != nil {
+		return creds, errors.New("Error reading credentials from the Secret Service: " + strings.TrimSpace(stderr.String()))
+	}
+
+	if err := json.Unmarshal(output, &creds); err != nil || creds.OauthToken == "" {
+		return creds, errNoCredentials
+	}
+	return creds, nil
+}
+
+func (secretServiceStore) Save(profile string, creds credentials) error {
+	if !secretServiceAvailable() {
+		return errSecretServiceUnavailable
+	}
+
+	jsonText, _ := json.Marshal(creds)
+	command := exec.Command("secret-tool", "store", "--label", "MongoHQ CLI ("+profile+")", "service", secretServiceName, "profile", profile)
+	command.Stdin = bytes.NewReader(jsonText)
+
+	if output, err := command.CombinedOutput(); err != nil {
+		return errors.New("Error writing credentials to the Secret Service: " + strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func (secretServiceStore) Delete(profile string) error {
+	if !secretServiceAvailable() {
+		return errSecretServiceUnavailable
+	}
+
+	command := exec.Command("secret-tool", "clear", "service", secretServiceName, "profile", profile)
+	if output, err := command.CombinedOutput(); err != nil && len(output) > 0 {
+		return errors.New("Error removing credentials from the Secret Service: " + strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+)
+
+// secretServiceStore is only available on Linux; elsewhere new logins use
+// the encrypted file.
+type secretServiceStore struct{}
+
+var errSecretServiceUnavailable = errors.New("The secret-service credential store is only available on Linux.")
+
+func secretServiceAvailable() bool {
+	return false
+}
+
+func (secretServiceStore) Load(profile string) (credentials, error) {
+	return credentials{}, errSecretServiceUnavailable
+}
+
+func (secretServiceStore) Save(profile string, creds credentials) error {
+	return errSecretServiceUnavailable
+}
+
+func (secretServiceStore) Delete(profile string) error {
+	return errSecretServiceUnavailable
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// The RFC 6070 inputs, with the keys PBKDF2-HMAC-SHA256 gives for them.
+var passphraseKeyTests = []struct {
+	passphrase, salt string
+	iterations       int
+	key              string
+}{
+	{"password", "salt", 1, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+	{"password", "salt", 2, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+	{"password", "salt", 4096, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+	{"passwordPASSWORDpassword", "saltSALTsaltSALTsaltSALTsaltSALTsalt", 4096, "348c89dbcbd32b2f32d814b8116e84cf2b17347ebc1800181c4e2a1fb8dd53e1"},
+}
+
+func TestPassphraseKey(t *testing.T) {
+	for _, test := range passphraseKeyTests {
+		key := hex.EncodeToString(passphraseKey(test.passphrase, []byte(test.salt), test.iterations))
+		if key != test.key {
+			t.Errorf("passphraseKey(%q, %q, %d) = %s, want %s", test.passphrase, test.salt, test.iterations, key, test.key)
+		}
+	}
+}
+
+func TestEncryptedFileStore(t *testing.T) {
+	isolate(t)
+	defer func() { credentialPassphrase = "" }()
+	store := encryptedFileStore{}
+	saved := credentials{Email: "user@example.com", OauthToken: "secret-token"}
+
+	t.Setenv("MONGOHQ_CREDENTIAL_PASSPHRASE", "correct horse")
+	if err := store.Save(defaultProfile, saved); err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := ioutil.ReadFile(store.path(defaultProfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(sealed), saved.OauthToken) || strings.Contains(string(sealed), saved.Email) {
+		t.Errorf("%s holds the credentials in the clear:\n%s", store.path(defaultProfile), sealed)
+	}
+	if stat, err := os.Stat(store.path(defaultProfile)); err != nil {
+		t.Fatal(err)
+	} else if stat.Mode().Perm()&0077 != 0 {
+		t.Errorf("%s has mode %v, want it private", store.path(defaultProfile), stat.Mode().Perm())
+	}
+
+	loaded, err := store.Load(defaultProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded != saved {
+		t.Errorf("Load gave %+v, want %+v", loaded, saved)
+	}
+
+	t.Setenv("MONGOHQ_CREDENTIAL_PASSPHRASE", "wrong horse")
+	if loaded, err := store.Load(defaultProfile); err == nil || err.Error() != "Incorrect passphrase for the stored credentials." {
+		t.Errorf("Load with the wrong passphrase gave %+v, %v", loaded, err)
+	}
+}
+
+func TestSecretServiceFallback(t *testing.T) {
+	isolate(t)
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", "")
+	updateConfig(func(config *Config) error {
+		config.CredentialStore = storeSecretService
+		return nil
+	})
+
+	if name, _, err := (&LoginController{}).credentialStore(); err != nil || name != storeEncryptedFile {
+		t.Errorf("credentialStore() = %q, %v without a session bus, want %q", name, err, storeEncryptedFile)
+	}
+
+	// asking for it by name is not second-guessed
+	if name, _, err := (&LoginController{Store: storeSecretService}).credentialStore(); err != nil || name != storeSecretService {
+		t.Errorf("credentialStore() = %q, %v with --credential-store secret-service", name, err)
+	}
+}
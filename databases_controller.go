@@ -1,119 +1,175 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"github.com/MongoHQ/mongohq-cli/mongohq"
+	"sort"
+	"strconv"
 )
 
-func (c *Controller) ListDatabases() {
-	databases, err := c.Api.GetDatabases()
+func (c *Controller) ListDatabases() error {
+	databases, err := c.Api.GetDatabases(c.Context)
 
 	if err != nil {
-		fmt.Println("Error retrieving databases: " + err.Error())
-		cliOSExit()
-		return
+		return fmt.Errorf("Error retrieving databases: %w", err)
 	}
 
-	fmt.Println("== My Databases")
+	if c.Format != formatText {
+		rows := table{headers: []string{"NAME", "STATUS", "PLAN", "DEPLOYMENT ID"}}
+		for _, database := range databases {
+			rows.add(database.Name, database.Status, database.Plan, database.DeploymentId)
+		}
+		return c.render(databases, rows)
+	}
+
+	fmt.Fprintln(c.Out, "== My Databases")
 	for _, database := range databases {
-		fmt.Println(database.Name)
+		fmt.Fprintln(c.Out, database.Name)
 	}
+	return nil
 }
 
-func (c *Controller) ShowDatabase(deploymentName, databaseName string) {
-	database, err := c.Api.GetDatabase(deploymentName, databaseName)
+func (c *Controller) ShowDatabase(deploymentName, databaseName string) error {
+	database, err := c.Api.GetDatabase(c.Context, deploymentName, databaseName)
 
 	if err != nil {
-		fmt.Println("Error retrieiving database: " + err.Error())
-		cliOSExit()
-		return
+		return fmt.Errorf("Error retrieiving database: %w", err)
 	}
 
-	fmt.Println("== " + database.Name)
-	fmt.Println(" name       : " + database.Name)
-	fmt.Println(" plan       : " + database.Plan)
-	fmt.Println(" status     : " + database.Status)
-	fmt.Println(" deployment : " + deploymentName)
+	if c.Format != formatText {
+		return c.renderDatabase(deploymentName, database)
+	}
+
+	fmt.Fprintln(c.Out, "== "+database.Name)
+	fmt.Fprintln(c.Out, " name       : "+database.Name)
+	fmt.Fprintln(c.Out, " plan       : "+database.Plan)
+	fmt.Fprintln(c.Out, " status     : "+database.Status)
+	fmt.Fprintln(c.Out, " deployment : "+deploymentName)
 
 	if database.Status == "running" {
-		users, err := c.Api.GetDatabaseUsers(deploymentName, databaseName)
+		users, err := c.Api.GetDatabaseUsers(c.Context, deploymentName, databaseName)
 
 		if err != nil {
-			fmt.Println(" == Error returning database users: " + err.Error())
+			fmt.Fprintln(c.Out, " == Error returning database users: "+err.Error())
 		} else {
-			fmt.Println(" == users")
+			fmt.Fprintln(c.Out, " == users")
 			for _, user := range users {
-				fmt.Println("  " + user.Username)
+				fmt.Fprintln(c.Out, "  "+user.Username)
 			}
 		}
 
-		stats, err := c.Api.GetDatabaseStats(database)
+		stats, err := c.Api.GetDatabaseStats(c.Context, database)
 
 		if err != nil {
-			fmt.Println(" == Error returning database stats: " + err.Error())
+			fmt.Fprintln(c.Out, " == Error returning database stats: "+err.Error())
 		} else {
-			fmt.Println(" == database usage stats per host")
+			fmt.Fprintln(c.Out, " == database usage stats per host")
 			for host, stat := range stats {
-				fmt.Println("  == " + host)
-				fmt.Println("   dataSize:  " + prettySize(float64(stat.DataSize)))
-				fmt.Println("   indexSize: " + prettySize(float64(stat.IndexSize)))
-				fmt.Println("   fileSize:  " + prettySize(float64(stat.FileSize)))
+				fmt.Fprintln(c.Out, "  == "+host)
+				fmt.Fprintln(c.Out, "   dataSize:  "+mongohq.PrettySize(float64(stat.DataSize)))
+				fmt.Fprintln(c.Out, "   indexSize: "+mongohq.PrettySize(float64(stat.IndexSize)))
+				fmt.Fprintln(c.Out, "   fileSize:  "+mongohq.PrettySize(float64(stat.FileSize)))
 			}
 		}
 	}
+	return nil
+}
+
+// databaseInfo is the full databases:info result for --format.
+type databaseInfo struct {
+	mongohq.Database
+	Deployment string                           `json:"deployment"`
+	Users      []mongohq.DatabaseUser           `json:"users"`
+	Stats      map[string]mongohq.DatabaseStats `json:"stats"`
+}
+
+func (c *Controller) renderDatabase(deploymentName string, database mongohq.Database) error {
+	info := databaseInfo{Database: database, Deployment: deploymentName}
+
+	if database.Status == "running" {
+		var err error
+		info.Users, err = c.Api.GetDatabaseUsers(c.Context, deploymentName, database.Name)
+		if err != nil {
+			return fmt.Errorf("Error returning database users: %w", err)
+		}
+
+		info.Stats, err = c.Api.GetDatabaseStats(c.Context, database)
+		if err != nil {
+			return fmt.Errorf("Error returning database stats: %w", err)
+		}
+	}
+
+	rows := table{headers: []string{"HOST", "OBJECTS", "DATA SIZE", "INDEX SIZE", "FILE SIZE"}}
+	for _, host := range sortedHosts(info.Stats) {
+		stat := info.Stats[host]
+		rows.add(host, strconv.Itoa(stat.Objects), mongohq.PrettySize(float64(stat.DataSize)), mongohq.PrettySize(float64(stat.IndexSize)), mongohq.PrettySize(float64(stat.FileSize)))
+	}
+	return c.render(info, rows)
+}
+
+func sortedHosts(stats map[string]mongohq.DatabaseStats) []string {
+	hosts := make([]string, 0, len(stats))
+	for host := range stats {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
 }
 
-func (c *Controller) DeleteDatabase(deploymentSlug, databaseName string, force bool) {
+func (c *Controller) DeleteDatabase(deploymentSlug, databaseName string, force bool) error {
 	if !force {
 		confirmDatabaseName := prompt("To confirm, type the name of the database to be deleted")
 
 		if databaseName != confirmDatabaseName {
-			fmt.Println("Confirmation of database name is incorrect.")
-			cliOSExit()
-			return
+			return errors.New("Confirmation of database name is incorrect.")
 		}
 	}
 
-	err := c.Api.RemoveDatabase(deploymentSlug, databaseName)
+	err := c.Api.RemoveDatabase(c.Context, deploymentSlug, databaseName)
 
 	if err != nil {
-		fmt.Println("Error removing database: " + err.Error())
-		cliOSExit()
-		return
+		return fmt.Errorf("Error removing database: %w", err)
 	}
 
-	fmt.Println("Removed database named: " + databaseName)
+	fmt.Fprintln(c.Out, "Removed database named: "+databaseName)
+	return nil
 }
 
-func (c *Controller) CreateDatabase(deploymentName, databaseName string) {
-	database, err := c.Api.CreateDatabase(deploymentName, databaseName)
+func (c *Controller) CreateDatabase(deploymentName, databaseName string) error {
+	database, err := c.Api.CreateDatabase(c.Context, deploymentName, databaseName)
 
 	if err != nil {
-		fmt.Println("Error creating database: " + err.Error())
-		cliOSExit()
-		return
+		return fmt.Errorf("Error creating database: %w", err)
 	}
 
-	fmt.Println("== " + database.Name)
-	fmt.Println(" status     :" + database.Status)
-	fmt.Println(" deployment :" + deploymentName)
+	fmt.Fprintln(c.Out, "== "+database.Name)
+	fmt.Fprintln(c.Out, " status     :"+database.Status)
+	fmt.Fprintln(c.Out, " deployment :"+deploymentName)
+	return nil
 }
 
-func (c *Controller) ListDatabaseUsers(deploymentId, databaseName string) {
-	databaseUsersSlice, err := c.Api.GetDatabaseUsers(deploymentId, databaseName)
+func (c *Controller) ListDatabaseUsers(deploymentId, databaseName string) error {
+	databaseUsersSlice, err := c.Api.GetDatabaseUsers(c.Context, deploymentId, databaseName)
 
 	if err != nil {
-		fmt.Println("Error retrieiving database users: " + err.Error())
-		cliOSExit()
-		return
+		return fmt.Errorf("Error retrieiving database users: %w", err)
+	} else if c.Format != formatText {
+		rows := table{headers: []string{"USERNAME", "READ ONLY"}}
+		for _, databaseUser := range databaseUsersSlice {
+			rows.add(databaseUser.Username, strconv.FormatBool(databaseUser.ReadOnly))
+		}
+		return c.render(databaseUsersSlice, rows)
 	} else {
-		fmt.Println("== Users for database " + databaseName)
+		fmt.Fprintln(c.Out, "== Users for database "+databaseName)
 		for _, databaseUser := range databaseUsersSlice {
-			fmt.Println("  " + databaseUser.Username)
+			fmt.Fprintln(c.Out, "  "+databaseUser.Username)
 		}
 	}
+	return nil
 }
 
-func (c *Controller) CreateDatabaseUser(deploymentId, databaseName, username, suppliedPassword string) {
+func (c *Controller) CreateDatabaseUser(deploymentId, databaseName, username, suppliedPassword string) error {
 	var password string
 	var err error
 
@@ -121,39 +177,33 @@ func (c *Controller) CreateDatabaseUser(deploymentId, databaseName, username, su
 		password, err = safeGetPass("Password (typing will be hidden): ")
 
 		if err != nil {
-			fmt.Println("Error returning password.  We may not be compliant with your system yet.  Please send us a message telling us about your system to support@mongohq.com.")
-			cliOSExit()
-			return
+			return errors.New("Error returning password.  We may not be compliant with your system yet.  Please send us a message telling us about your system to support@mongohq.com.")
 		}
 
 		confirmedPassword, _ := safeGetPass("Confirm password: ")
 
 		if password != confirmedPassword {
-			fmt.Println("Password confirmation failed.")
-			cliOSExit()
-			return
+			return errors.New("Password confirmation failed.")
 		}
 	} else {
 		password = suppliedPassword
 	}
 
-	_, err = c.Api.CreateDatabaseUser(deploymentId, databaseName, username, password)
+	_, err = c.Api.CreateDatabaseUser(c.Context, deploymentId, databaseName, username, password)
 
 	if err != nil {
-		fmt.Println("Error creating database user: " + err.Error())
-		cliOSExit()
-		return
+		return fmt.Errorf("Error creating database user: %w", err)
 	}
-	fmt.Println("User " + username + " created.")
+	fmt.Fprintln(c.Out, "User "+username+" created.")
+	return nil
 }
 
-func (c *Controller) DeleteDatabaseUser(deploymentId, databaseName, username string) {
-	_, err := c.Api.RemoveDatabaseUser(deploymentId, databaseName, username)
+func (c *Controller) DeleteDatabaseUser(deploymentId, databaseName, username string) error {
+	_, err := c.Api.RemoveDatabaseUser(c.Context, deploymentId, databaseName, username)
 
 	if err != nil {
-		fmt.Println("Error removing database user: " + err.Error())
-		cliOSExit()
-		return
+		return fmt.Errorf("Error removing database user: %w", err)
 	}
-	fmt.Println("User " + username + " removed.")
+	fmt.Fprintln(c.Out, "User "+username+" removed.")
+	return nil
 }
@@ -1,104 +1,452 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"github.com/MongoHQ/mongohq-cli/mongohq"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
-func (c *Controller) ListDeployments() {
-	deployments, err := c.Api.GetDeployments()
+// deploymentColumn is a column of the deployments listing, for --columns
+// and --sort.
+type deploymentColumn struct {
+	name   string
+	header string
+	value  func(deployment accountDeployment) string
+}
+
+var deploymentColumns = []deploymentColumn{
+	{"account", "ACCOUNT", func(d accountDeployment) string { return d.Account }},
+	{"name", "NAME", func(d accountDeployment) string { return d.NameOrId() }},
+	{"plan", "PLAN", func(d accountDeployment) string { return d.Plan }},
+	{"status", "STATUS", func(d accountDeployment) string { return d.Status }},
+	{"location", "LOCATION", func(d accountDeployment) string { return d.Location }},
+	{"version", "VERSION", func(d accountDeployment) string { return d.Version }},
+	{"primary", "CURRENT PRIMARY", func(d accountDeployment) string { return d.CurrentPrimary }},
+	{"members", "MEMBERS", func(d accountDeployment) string { return strings.Join(d.Members, ",") }},
+	{"databases", "DATABASES", func(d accountDeployment) string {
+		var databases []string
+		for _, database := range d.Databases {
+			databases = append(databases, database.Name)
+		}
+		return strings.Join(databases, ",")
+	}},
+}
+
+var defaultDeploymentColumns = "name,plan,status,location,version"
+
+func deploymentColumnNames() string {
+	var names []string
+	for _, column := range deploymentColumns {
+		names = append(names, column.name)
+	}
+	return strings.Join(names, ", ")
+}
+
+func lookupDeploymentColumn(name string) (deploymentColumn, error) {
+	for _, column := range deploymentColumns {
+		if column.name == strings.ToLower(strings.TrimSpace(name)) {
+			return column, nil
+		}
+	}
+	return deploymentColumn{}, errors.New("Unknown deployments column " + name + ".  Columns are " + deploymentColumnNames() + ".")
+}
+
+// DeploymentListing is how the deployments command shows deployments:
+// the columns, the column to sort by, and the filters, each a comma
+// separated list of values to accept.
+type DeploymentListing struct {
+	Columns   string
+	Sort      string
+	Statuses  string
+	Plans     string
+	Locations string
+	Versions  string
+}
+
+// columns are the listing's columns, with the account first for
+// --all-accounts.
+func (l DeploymentListing) columns(allAccounts bool) ([]deploymentColumn, error) {
+	names := l.Columns
+	if names == "" {
+		names = defaultDeploymentColumns
+		if allAccounts {
+			names = "account," + names
+		}
+	}
+
+	var columns []deploymentColumn
+	for _, name := range strings.Split(names, ",") {
+		column, err := lookupDeploymentColumn(name)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+// needsDetails reports whether the listing shows more than the names the
+// deployments list always carries.  JSON, YAML and templates show every
+// field.
+func (l DeploymentListing) needsDetails(format string, columns []deploymentColumn) bool {
+	if format != formatText && format != formatTable {
+		return true
+	} else if l.Statuses != "" || l.Plans != "" || l.Locations != "" || l.Versions != "" {
+		return true
+	} else if by := strings.TrimPrefix(l.Sort, "-"); by != "" && by != "name" && by != "account" {
+		return true
+	}
+
+	for _, column := range columns {
+		if column.name != "name" && column.name != "account" {
+			return true
+		}
+	}
+	return false
+}
+
+func (l DeploymentListing) matches(deployment mongohq.Deployment) bool {
+	return matchesAny(l.Statuses, deployment.Status, "") &&
+		matchesAny(l.Plans, deployment.Plan, "") &&
+		matchesAny(l.Locations, deployment.Location, ":") &&
+		matchesAny(l.Versions, deployment.Version, ".")
+}
+
+// matchesAny reports whether value is one of the comma separated filter,
+// ignoring case, or starts with one followed by separator: with ":", aws
+// matches aws:us-east-1, and with ".", 2.6 matches 2.6.3.  An empty filter
+// matches everything.
+func matchesAny(filter, value, separator string) bool {
+	if filter == "" {
+		return true
+	}
+
+	value = strings.ToLower(value)
+	for _, want := range strings.Split(strings.ToLower(filter), ",") {
+		want = strings.TrimSpace(want)
+		if value == want || (separator != "" && strings.HasPrefix(value, want+separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortDeployments orders deployments by the column named by by, or in
+// reverse with a leading "-", then by account and name.
+func sortDeployments(deployments []accountDeployment, by string) error {
+	descending := strings.HasPrefix(by, "-")
+	column, err := lookupDeploymentColumn(strings.TrimPrefix(by, "-"))
+	if err != nil {
+		return err
+	}
+
+	compare := strings.Compare
+	if column.name == "version" {
+		compare = compareVersions
+	}
+
+	sort.SliceStable(deployments, func(i, j int) bool {
+		if order := compare(column.value(deployments[i]), column.value(deployments[j])); order != 0 {
+			return (order < 0) != descending
+		} else if deployments[i].Account != deployments[j].Account {
+			return deployments[i].Account < deployments[j].Account
+		}
+		return deployments[i].NameOrId() < deployments[j].NameOrId()
+	})
+	return nil
+}
+
+// compareVersions compares dotted versions number by number, so that 2.10
+// comes after 2.6.
+func compareVersions(a, b string) int {
+	aParts, bParts := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(aParts) && i < len(bParts); i++ {
+		aNumber, aErr := strconv.Atoi(aParts[i])
+		bNumber, bErr := strconv.Atoi(bParts[i])
+		if aErr == nil && bErr == nil {
+			if aNumber != bNumber {
+				return aNumber - bNumber
+			}
+		} else if order := strings.Compare(aParts[i], bParts[i]); order != 0 {
+			return order
+		}
+	}
+	return len(aParts) - len(bParts)
+}
+
+// fillDeploymentDetails fetches, concurrently, the details of deployments
+// the list endpoint only gave the name and id of, as many at once as the
+// Api's Requests allow.  Deployments whose details cannot be fetched are
+// left as they are, and reported.
+func (c *Controller) fillDeploymentDetails(api *mongohq.Api, deployments []mongohq.Deployment) error {
+	errs := make([]error, len(deployments))
+
+	var wait sync.WaitGroup
+	for i := range deployments {
+		deployment := deployments[i]
+		if deployment.Plan != "" || deployment.Status != "" || deployment.Location != "" || deployment.Version != "" {
+			continue
+		}
+
+		wait.Add(1)
+		go func(i int) {
+			defer wait.Done()
+			detail, err := api.GetDeployment(c.Context, deployments[i].NameOrId())
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			deployments[i] = detail
+		}(i)
+	}
+	wait.Wait()
+
+	var failed partialError
+	for i, err := range errs {
+		if err != nil {
+			failed.add("Error retrieving deployment "+deployments[i].NameOrId()+": ", err)
+		}
+	}
+	return failed.err()
+}
+
+func (c *Controller) ListDeployments(listing DeploymentListing) error {
+	columns, err := listing.columns(false)
+	if err != nil {
+		return err
+	}
 
+	deployments, err := c.Api.GetDeployments(c.Context)
 	if err != nil {
-		fmt.Println("Error retrieving deployments: " + err.Error())
+		return fmt.Errorf("Error retrieving deployments: %w", err)
+	}
+
+	var fetchErr error
+	if listing.needsDetails(c.Format, columns) {
+		fetchErr = c.fillDeploymentDetails(c.Api, deployments)
+	}
+
+	var listed []accountDeployment
+	for _, deployment := range deployments {
+		listed = append(listed, accountDeployment{Deployment: deployment})
+	}
+	listed, err = c.arrangeDeployments(listed, listing)
+	if err != nil {
+		return err
+	}
+
+	if c.Format == formatText || c.Format == formatTable {
+		err = c.writeDeployments(listed, columns)
 	} else {
-		fmt.Println("== My Deployments")
-		for _, deployment := range deployments {
-			fmt.Println(deployment.NameOrId())
+		// without the account field, as before --all-accounts
+		shown := []mongohq.Deployment{}
+		for _, deployment := range listed {
+			shown = append(shown, deployment.Deployment)
 		}
+		err = c.render(shown, table{})
 	}
+	if err != nil {
+		return err
+	}
+	return fetchErr
+}
+
+// accountDeployment tags a deployment with its account, for
+// --all-accounts.
+type accountDeployment struct {
+	Account string `json:"account"`
+	mongohq.Deployment
 }
 
-func (c *Controller) ShowDeployment(deploymentId string) {
-	deployment, err := c.Api.GetDeployment(deploymentId)
+// ListDeploymentsForAllAccounts lists the deployments of every account,
+// fetching them concurrently.  Accounts that fail are reported after the
+// others are listed.
+func (c *Controller) ListDeploymentsForAllAccounts(listing DeploymentListing) error {
+	columns, err := listing.columns(true)
+	if err != nil {
+		return err
+	}
 
+	accounts, err := c.Api.GetAccounts(c.Context)
 	if err != nil {
-		fmt.Println("Error retrieving deployment: " + err.Error())
+		return fmt.Errorf("Error retrieving accounts: %w", err)
+	}
+
+	results := make([][]mongohq.Deployment, len(accounts))
+	fetchErr := c.eachAccount(accounts, func(i int, api *mongohq.Api) (err error) {
+		results[i], err = api.GetDeployments(c.Context)
+		if err == nil && listing.needsDetails(c.Format, columns) {
+			err = c.fillDeploymentDetails(api, results[i])
+		}
+		return err
+	})
+
+	var deployments []accountDeployment
+	for i, account := range accounts {
+		for _, deployment := range results[i] {
+			deployments = append(deployments, accountDeployment{Account: account.Slug, Deployment: deployment})
+		}
+	}
+	deployments, err = c.arrangeDeployments(deployments, listing)
+	if err != nil {
+		return err
+	}
+
+	if c.Format == formatText || c.Format == formatTable {
+		err = c.writeDeployments(deployments, columns)
 	} else {
-		fmt.Println("== " + deployment.NameOrId())
-		fmt.Println(" name            : " + deployment.NameOrId())
-		fmt.Println(" plan            : " + deployment.Plan)
-		fmt.Println(" status          : " + deployment.Status)
-		fmt.Println(" location        : " + deployment.Location)
-		fmt.Println(" current primary : " + deployment.CurrentPrimary)
-		fmt.Println(" members         : " + strings.Join(deployment.Members, ","))
-		fmt.Println(" version         : " + deployment.Version)
+		err = c.render(deployments, table{})
+	}
+	if err != nil {
+		return err
+	}
+	return fetchErr
+}
+
+// arrangeDeployments filters and sorts deployments for a listing.  They
+// are sorted by name, or by account then name for --all-accounts, unless
+// the listing says otherwise.
+func (c *Controller) arrangeDeployments(deployments []accountDeployment, listing DeploymentListing) ([]accountDeployment, error) {
+	arranged := []accountDeployment{}
+	for _, deployment := range deployments {
+		if listing.matches(deployment.Deployment) {
+			arranged = append(arranged, deployment)
+		}
+	}
+
+	by := listing.Sort
+	if by == "" {
+		by = "name"
+		if len(arranged) > 0 && arranged[0].Account != "" {
+			by = "account"
+		}
+	}
+	return arranged, sortDeployments(arranged, by)
+}
+
+// writeDeployments writes the text and table listings, which differ only
+// in the heading.
+func (c *Controller) writeDeployments(deployments []accountDeployment, columns []deploymentColumn) error {
+	rows := table{}
+	for _, column := range columns {
+		rows.headers = append(rows.headers, column.header)
+	}
+	for _, deployment := range deployments {
+		var row []string
+		for _, column := range columns {
+			row = append(row, column.value(deployment))
+		}
+		rows.add(row...)
+	}
+
+	if c.Format == formatTable {
+		return rows.write(c.Out)
+	}
+
+	fmt.Fprintln(c.Out, "== My Deployments")
+	if len(deployments) == 0 {
+		fmt.Fprintln(c.Out, "No deployments.")
+		return nil
+	}
+	return rows.write(c.Out)
+}
+
+func (c *Controller) ShowDeployment(deploymentId string) error {
+	deployment, err := c.Api.GetDeployment(c.Context, deploymentId)
+
+	if err != nil {
+		return fmt.Errorf("Error retrieving deployment: %w", err)
+	} else if c.Format != formatText {
+		return c.render(deployment, deploymentsTable([]mongohq.Deployment{deployment}))
+	} else {
+		fmt.Fprintln(c.Out, "== "+deployment.NameOrId())
+		fmt.Fprintln(c.Out, " name            : "+deployment.NameOrId())
+		fmt.Fprintln(c.Out, " plan            : "+deployment.Plan)
+		fmt.Fprintln(c.Out, " status          : "+deployment.Status)
+		fmt.Fprintln(c.Out, " location        : "+deployment.Location)
+		fmt.Fprintln(c.Out, " current primary : "+deployment.CurrentPrimary)
+		fmt.Fprintln(c.Out, " members         : "+strings.Join(deployment.Members, ","))
+		fmt.Fprintln(c.Out, " version         : "+deployment.Version)
 
 		if deployment.AllowMultipleDatabases {
-			fmt.Println("  multiple databases?: true")
+			fmt.Fprintln(c.Out, "  multiple databases?: true")
+		}
+
+		fmt.Fprintln(c.Out, "  == Databases")
+		for _, database := range deployment.Databases {
+			fmt.Fprintln(c.Out, "    "+database.Name)
 		}
+	}
+	return nil
+}
 
-		fmt.Println("  == Databases")
+func deploymentsTable(deployments []mongohq.Deployment) table {
+	rows := table{headers: []string{"NAME", "PLAN", "STATUS", "LOCATION", "VERSION", "CURRENT PRIMARY", "DATABASES"}}
+	for _, deployment := range deployments {
+		var databases []string
 		for _, database := range deployment.Databases {
-			fmt.Println("    " + database.Name)
+			databases = append(databases, database.Name)
 		}
+		rows.add(deployment.NameOrId(), deployment.Plan, deployment.Status, deployment.Location, deployment.Version, deployment.CurrentPrimary, strings.Join(databases, ","))
 	}
+	return rows
 }
 
-func (c *Controller) RenameDeployment(deploymentId, name string) {
-	_, err := c.Api.RenameDeployment(deploymentId, name)
+func (c *Controller) RenameDeployment(deploymentId, name string) error {
+	_, err := c.Api.RenameDeployment(c.Context, deploymentId, name)
 
 	if err != nil {
-		fmt.Println("Error renaming deployment: " + err.Error())
+		return fmt.Errorf("Error renaming deployment: %w", err)
 	} else {
-		fmt.Println("Renamed deployment to " + name + ".  You will need to reference it by the new name.")
+		fmt.Fprintln(c.Out, "Renamed deployment to "+name+".  You will need to reference it by the new name.")
 	}
+	return nil
 }
 
-func (c *Controller) CreateDeployment(deploymentName, databaseName, location string) {
-	deployment, err := c.Api.CreateDeployment(deploymentName, databaseName, location)
+func (c *Controller) CreateDeployment(deploymentName, databaseName, location string) error {
+	deployment, err := c.Api.CreateDeployment(c.Context, deploymentName, databaseName, location)
 
 	if err != nil {
-		fmt.Println("Error creating deployment: " + err.Error())
+		return fmt.Errorf("Error creating deployment: %w", err)
 	} else {
-		fmt.Println("== Building deployment " + deploymentName + " with database " + databaseName + " in location " + location)
+		fmt.Fprintln(c.Out, "== Building deployment "+deploymentName+" with database "+databaseName+" in location "+location)
 
-		c.pollNewDeployment(deployment)
+		return c.pollNewDeployment(deployment)
 	}
 }
 
-func (c *Controller) DeleteDeployment(deploymentName string, force bool) {
+func (c *Controller) DeleteDeployment(deploymentName string, force bool) error {
 	if !force {
 		confirmDeploymentName := prompt("To confirm, type the name of the deployment to be deleted")
 
 		if deploymentName != confirmDeploymentName {
-			fmt.Println("Confirmation of deployment name is incorrect.")
-			cliOSExit()
-			return
+			return errors.New("Confirmation of deployment name is incorrect.")
 		}
 	}
 
-	err := c.Api.RemoveDeployment(deploymentName)
+	err := c.Api.RemoveDeployment(c.Context, deploymentName)
 
 	if err != nil {
-		fmt.Println("Error removing deployment: " + err.Error())
-		cliOSExit()
-		return
+		return fmt.Errorf("Error removing deployment: %w", err)
 	}
 
-	fmt.Println("Removed deployment named: " + deploymentName)
+	fmt.Fprintln(c.Out, "Removed deployment named: "+deploymentName)
+	return nil
 }
 
-func (c *Controller) DeploymentMongoStat(deploymentSlug string) {
+func (c *Controller) DeploymentMongoStat(deploymentSlug string) error {
 	hostRegex := regexp.MustCompile(".(?:mongohq|mongolayer).com")
 	loopCount := 0
 
-	outputFormatter := func(mongoStats map[string]MongoStat, err error) {
+	outputFormatter := func(mongoStats map[string]mongohq.MongoStat, err error) {
 		if err != nil {
-			fmt.Println("Error authenticating connection to websocket.")
-			cliOSExit()
+			fmt.Fprintln(c.Err, "Error reading mongostat: "+err.Error())
 			return
 		}
 
@@ -121,36 +469,42 @@ func (c *Controller) DeploymentMongoStat(deploymentSlug string) {
 		sprintfFormat := "%" + strconv.Itoa(hostLength) + "s" + "%7s%7s%7s%7s%8s%8s%8d%8s%8s%8s%7d%" + strconv.Itoa(lockLength) + "s%11d%6d|%-3d%6d|%-3d%7s%7s%6d%11s\n"
 
 		if loopCount%5 == 0 {
-			fmt.Printf(headerFormat, "host", "insert", "query", "update", "delete", "getmore", "command", "flush", "mapped", "vsize", "res", "faults", "locked %", "idx miss %", "qr", "qw", "ar", "aw", "netIn", "netOut", "conn", "time")
+			fmt.Fprintf(c.Out, headerFormat, "host", "insert", "query", "update", "delete", "getmore", "command", "flush", "mapped", "vsize", "res", "faults", "locked %", "idx miss %", "qr", "qw", "ar", "aw", "netIn", "netOut", "conn", "time")
 		}
 
 		now := time.Now()
 
 		for host, stat := range mongoStats {
-			fmt.Printf(sprintfFormat, hostRegex.ReplaceAllLiteralString(host, ""), stat.Inserts, stat.Query, stat.Update, stat.Delete, stat.Getmore, stat.Command, stat.Flushes, stat.PrettyMapped(), stat.PrettyVsize(), stat.PrettyRes(), stat.Faults, stat.Locked, stat.IdxMiss, stat.Qr, stat.Qw, stat.Ar, stat.Aw, stat.PrettyNetIn(), stat.PrettyNetOut(), stat.Conn, now.Format("15:04:05"))
+			fmt.Fprintf(c.Out, sprintfFormat, hostRegex.ReplaceAllLiteralString(host, ""), stat.Inserts, stat.Query, stat.Update, stat.Delete, stat.Getmore, stat.Command, stat.Flushes, stat.PrettyMapped(), stat.PrettyVsize(), stat.PrettyRes(), stat.Faults, stat.Locked, stat.IdxMiss, stat.Qr, stat.Qw, stat.Ar, stat.Aw, stat.PrettyNetIn(), stat.PrettyNetOut(), stat.Conn, now.Format("15:04:05"))
 		}
 
 		loopCount += 1
 	}
 
-	err := c.Api.DeploymentMongostat(deploymentSlug, outputFormatter)
+	err := c.Api.DeploymentMongostat(c.Context, deploymentSlug, outputFormatter)
 
 	if err != nil {
-		fmt.Println("Error: " + err.Error())
-		cliOSExit()
-		return
+		// streams run until interrupted, so that is not worth reporting
+		if c.Context.Err() != nil {
+			return quietError{err}
+		}
+		return fmt.Errorf("Error: %w", err)
 	}
+	return nil
 }
 
-func (c *Controller) DeploymentOplog(deploymentSlug string) {
+func (c *Controller) DeploymentOplog(deploymentSlug string) error {
 	outputFormatter := func(entry string, err error) {
-		fmt.Println(entry)
+		fmt.Fprintln(c.Out, entry)
 	}
 
-	err := c.Api.DeploymentOplog(deploymentSlug, outputFormatter)
+	err := c.Api.DeploymentOplog(c.Context, deploymentSlug, outputFormatter)
 	if err != nil {
-		fmt.Println("Error: " + err.Error())
-		cliOSExit()
-		return
+		// streams run until interrupted, so that is not worth reporting
+		if c.Context.Err() != nil {
+			return quietError{err}
+		}
+		return fmt.Errorf("Error: %w", err)
 	}
+	return nil
 }
@@ -4,17 +4,24 @@ import (
 	"fmt"
 )
 
-func (c *Controller) ListLocations() {
-	providersLocations, err := c.Api.GetLocations()
+func (c *Controller) ListLocations() error {
+	providersLocations, err := c.Api.GetLocations(c.Context)
 
 	if err != nil {
-		fmt.Println("Error returning locations: " + err.Error())
-		cliOSExit()
-		return
+		return fmt.Errorf("Error returning locations: %w", err)
 	}
 
-	fmt.Println("== locations")
+	if c.Format != formatText {
+		rows := table{headers: []string{"LOCATION"}}
+		for _, location := range providersLocations {
+			rows.add(location)
+		}
+		return c.render(providersLocations, rows)
+	}
+
+	fmt.Fprintln(c.Out, "== locations")
 	for _, location := range providersLocations {
-		fmt.Println("  " + location)
+		fmt.Fprintln(c.Out, "  "+location)
 	}
+	return nil
 }
@@ -1,144 +1,399 @@
 package main
 
 import (
+	"github.com/MongoHQ/mongohq-cli/mongohq"
 	//"fmt"
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"os"
+	"strings"
+	"sync"
 )
 
-// Login is its on controller because it acts differently than others
+// Login is its on controller because it acts differently than others.
+// OauthToken, from --token or MONGOHQ_API_TOKEN, is used as is instead of
+// the stored credentials.  Store overrides the profile's credential store.
+// Otp, from --otp or MONGOHQ_OTP, is sent as the 2fa code instead of
+// prompting for one.  Account, from --account, overrides the default
+// account for the command.
 type LoginController struct {
-	Api        *Api
+	Api        *mongohq.Api
+	Context    context.Context
+	Out        io.Writer
+	Account    string
 	OauthToken string
+	Otp        string
+	Store      string
 	Username   string
+
+	reauthLock sync.Mutex
 }
 
-var configPath = os.Getenv("HOME") + "/.mongohq"
-var credentialFile = configPath + "/credentials"
+var credentialFile string
 
 var Email, OauthToken string
 
-func (c *LoginController) login() error {
-	fmt.Println("Enter your MongoHQ credentials.")
-	username := prompt("Email")
+// login runs the login flow named by method: loginPassword prompts for
+// the email and password, loginWeb and loginDevice go through the browser.
+func (c *LoginController) login(method string) error {
+	var username string
+	if method == loginPassword {
+		fmt.Fprintln(c.Out, "Enter your MongoHQ credentials.")
+		username = prompt("Email")
+	}
+
+	if err := c.authenticateWith(c.Context, method, username); err != nil {
+		return err
+	}
+
+	fmt.Fprint(c.Out, "\nAuthentication complete.\n\n\n")
+
+	return c.chooseDefaultAccount()
+}
+
+func (c *LoginController) chooseDefaultAccount() error {
+	accounts, err := c.withoutReauthentication().GetAccounts(c.Context)
+	if err != nil {
+		return errors.New("Error returning accounts after authentication.  Seems like something with authentication may have failed.  Please try again.")
+	}
+
+	var accountSlug string
+	if len(accounts) == 1 {
+		accountSlug = accounts[0].Slug
+	} else {
+		fmt.Fprintln(c.Out, "== Accounts")
+		for _, account := range accounts {
+			fmt.Fprintln(c.Out, "  "+account.Slug)
+		}
+		accountSlug = prompt("Which account should be default? (Can be changed later with config:account)")
+	}
+
+	return updateConfig(func(config *Config) error {
+		config.AccountSlug = accountSlug
+		return nil
+	})
+}
+
+// authenticate asks for the password, and a 2fa token when the account
+// needs one, then stores the new oauth token and starts using it.
+func (c *LoginController) authenticate(ctx context.Context, username string) error {
 	password, err := safeGetPass("Password (typing will be hidden): ")
 
 	if err != nil {
 		return errors.New("Error returning password.  We may not be compliant with your system yet.  Please send us a message telling us about your system to support@mongohq.com.")
 	}
 
-	oauthToken, err := c.Api.Authenticate(username, password, "")
+	oauthToken, err := c.Api.Authenticate(ctx, username, password, c.Otp)
 
-	return c.processAuthenticationResponse(username, password, oauthToken, err)
+	return c.processAuthenticationResponse(ctx, username, password, oauthToken, err)
 }
 
-func (c *LoginController) processAuthenticationResponse(username, password, oauthToken string, err error) error {
-	if err != nil {
-		if err.Error() == "2fa token required" {
-			twoFactorToken := prompt("2fa token")
-			oauthToken, err := c.Api.Authenticate(username, password, twoFactorToken)
-			return c.processAuthenticationResponse(username, password, oauthToken, err)
+// authenticateWith logs in with the given method and remembers it, so an
+// expired login is renewed the same way.
+func (c *LoginController) authenticateWith(ctx context.Context, method, username string) error {
+	var err error
+	switch method {
+	case loginPassword:
+		err = c.authenticate(ctx, username)
+	case loginWeb, loginDevice:
+		var token string
+		if method == loginWeb {
+			token, err = c.webAuthenticate(ctx)
 		} else {
-			return err
+			token, err = c.deviceAuthenticate(ctx)
 		}
-	} else {
-		err = c.storeCredentials(username, oauthToken)
+		if err == nil {
+			err = c.storeWebLogin(ctx, token)
+		}
+	default:
+		err = errors.New("Unknown login method " + method + ".")
+	}
+	if err != nil {
+		return err
+	}
 
-		if err != nil {
+	return updateConfig(func(config *Config) error {
+		config.Login = method
+		return nil
+	})
+}
+
+// maxOtpAttempts bounds how many 2fa codes a login asks for.
+const maxOtpAttempts = 3
+
+var errOtpRejected = errors.New("The 2fa code given with --otp or MONGOHQ_OTP was rejected.  It may have expired; codes from an authenticator app change every 30 seconds.")
+
+func (c *LoginController) processAuthenticationResponse(ctx context.Context, username, password, oauthToken string, err error) error {
+	for attempt := 1; err != nil; attempt++ {
+		var otpErr *mongohq.OtpRequiredError
+		if !errors.As(err, &otpErr) {
 			return err
-		} else {
-			fmt.Println("\nAuthentication complete.\n\n")
-
-			c.Api.OauthToken = oauthToken
-
-			accounts, err := c.Api.GetAccounts()
-			if err != nil {
-				return errors.New("Error returning accounts after authentication.  Seems like something with authentication may have failed.  Please try again.")
-			}
-
-			config := getConfig()
-			if len(accounts) == 1 {
-				config.AccountSlug = accounts[0].Slug
-			} else {
-				fmt.Println("== Accounts")
-				for _, account := range accounts {
-					fmt.Println("  " + account.Slug)
-				}
-				accountSlug := prompt("Which account should be default? (Can be changed later with config:account)")
-				config.AccountSlug = accountSlug
-			}
-			config.Save()
-
-			return nil
 		}
+
+		if otpErr.Rejected && attempt == 1 && c.Otp != "" {
+			return errOtpRejected
+		} else if attempt > maxOtpAttempts {
+			return errors.New("Too many incorrect 2fa codes.  Please try logging in again.")
+		} else if otpErr.Rejected {
+			fmt.Fprintln(c.Out, "That code was not accepted.")
+		}
+
+		twoFactorToken := prompt(otpPrompt(otpErr.Methods))
+		oauthToken, err = c.Api.Authenticate(ctx, username, password, twoFactorToken)
 	}
+
+	err = c.storeCredentials(username, oauthToken)
+	if err != nil {
+		return err
+	}
+
+	c.Api.SetToken(oauthToken)
+	return nil
 }
 
-func (c *LoginController) storeCredentials(username, oauth string) error {
-	credentials := make(map[string]interface{})
-	credentials["email"] = username
-	credentials["oauth_token"] = oauth
+// otpPrompt asks for whichever kinds of code the API will take.
+func otpPrompt(methods []string) string {
+	var kinds []string
+	for _, method := range methods {
+		switch method {
+		case mongohq.OtpSms:
+			kinds = append(kinds, "code sent to your phone by SMS")
+		case mongohq.OtpApp:
+			kinds = append(kinds, "code from your authenticator app")
+		case mongohq.OtpBackup:
+			kinds = append(kinds, "a backup code")
+		}
+	}
+
+	if len(kinds) == 0 {
+		return "2fa token"
+	}
+	text := strings.Join(kinds, ", or ")
+	return "2fa: " + strings.ToUpper(text[:1]) + text[1:]
+}
+
+// errAuthExpired and errTokenRejected are returned when the API rejects the
+// token and logging in again is not an option.
+var errAuthExpired = errors.New("Your MongoHQ login has expired or been revoked, and there is no terminal to log in again on.\nRun a mongohq command from a terminal to log in, or set MONGOHQ_API_TOKEN.")
+var errTokenRejected = errors.New("The API token given with --token or MONGOHQ_API_TOKEN was rejected.  It may have expired or been revoked.")
+
+// reauthenticate is the Api's Reauthenticate hook.  When the API rejects
+// the stored token, it runs the login again in place, so the request that
+// failed can be retried and a long shell session carries on.
+func (c *LoginController) reauthenticate(ctx context.Context, rejectedToken string) (string, error) {
+	c.reauthLock.Lock()
+	defer c.reauthLock.Unlock()
+
+	// a request running alongside this one has already logged in again
+	if c.Api.Token() != rejectedToken {
+		return c.Api.Token(), nil
+	}
+
+	if c.OauthToken != "" {
+		return "", errTokenRejected
+	} else if !isInteractive() {
+		return "", errAuthExpired
+	}
+
+	fmt.Fprintln(c.Out, "\nYour MongoHQ login has expired or been revoked.  Log in again to continue.")
+	config := getConfig()
+	username := config.Email
+	if config.Login == loginPassword {
+		if username == "" {
+			username = prompt("Email")
+		} else {
+			fmt.Fprintln(c.Out, "Email: "+username)
+		}
+	}
 
-	jsonText, _ := json.Marshal(credentials)
+	if err := c.authenticateWith(ctx, config.Login, username); err != nil {
+		return "", err
+	}
 
-	err := os.MkdirAll(configPath, 0700)
+	fmt.Fprint(c.Out, "\nAuthentication complete.\n\n")
+	return c.Api.Token(), nil
+}
 
+// withoutReauthentication copies the Api for the requests made while
+// logging in, and for the logout, which must fail on a 401 rather than
+// start another login.
+func (c *LoginController) withoutReauthentication() *mongohq.Api {
+	api := c.Api.ForAccount(c.Api.AccountSlug)
+	api.Reauthenticate = nil
+	return api
+}
+
+// credentialStore picks the store from --credential-store or
+// MONGOHQ_CREDENTIAL_STORE, then the one the profile already uses.  A
+// profile kept in the Secret Service falls back to the default store once
+// secret-tool or the D-Bus session is gone, so that logging in again works.
+func (c *LoginController) credentialStore() (string, credentialStore, error) {
+	name := c.Store
+	if name == "" {
+		name = savedCredentialStore()
+		if name == storeSecretService && !secretServiceAvailable() {
+			name = defaultCredentialStore()
+		}
+	}
+	store, err := credentialStoreFor(name)
+	return name, store, err
+}
+
+func (c *LoginController) storeCredentials(username, oauth string) error {
+	name, store, err := c.credentialStore()
 	if err != nil {
-		return errors.New("Error creating directory " + configPath)
+		return err
 	}
 
-	err = ioutil.WriteFile(credentialFile, jsonText, 0400)
+	if name == storePlaintext {
+		fmt.Fprintln(c.Out, "Storing your token unencrypted in "+credentialFile+".")
+	}
 
+	err = store.Save(activeProfile, credentials{Email: username, OauthToken: oauth})
 	if err != nil {
-		err = errors.New("Error writing credentials to " + credentialFile)
+		return err
 	}
 
-	return err
+	return updateConfig(func(config *Config) error {
+		config.CredentialStore = name
+		config.Email = username
+		return nil
+	})
 }
 
-func (c *LoginController) readCredentialFile() (jsonResponse map[string]interface{}, err error) {
-	if _, err := os.Stat(credentialFile); os.IsNotExist(err) { // check if file exists
-		return nil, errors.New("Credential file does not exist.")
-	} else {
-		jsonText, err := ioutil.ReadFile(credentialFile)
-		_ = json.Unmarshal(jsonText, &jsonResponse)
-
-		c.Api.OauthToken = jsonResponse["oauth_token"].(string)
+func (c *LoginController) readCredentials() error {
+	_, store, err := c.credentialStore()
+	if err != nil {
+		return err
+	}
 
-		return jsonResponse, err
+	creds, err := store.Load(activeProfile)
+	if err == errNoCredentials && c.Store == "" && savedCredentialStore() == storeSecretService && !secretServiceAvailable() {
+		fmt.Fprintln(os.Stderr, "This profile's login is in the Secret Service.  "+errSecretServiceUnavailable.Error())
 	}
+	if err != nil {
+		return err
+	}
+
+	c.Api.SetToken(creds.OauthToken)
+	return nil
 }
 
-func (l *LoginController) RequireAuth() {
-	l.verifyAuth()
+func (l *LoginController) RequireAuth() error {
+	return l.verifyAuth()
 }
 
-func (c *LoginController) Logout() {
-	_, err := c.Api.restDelete(c.Api.apiUrl("/authorization"))
+func (c *LoginController) Logout() error {
+	err := c.readCredentials()
+	if err == nil {
+		// a rejected token has nothing left to revoke, and logging in again
+		// here would only revoke the new login
+		err = c.withoutReauthentication().DeleteAuthorization(c.Context)
+	}
 
-	os.Remove(credentialFile)
-	os.Remove(configFile)
+	if _, store, storeErr := c.credentialStore(); storeErr == nil {
+		store.Delete(activeProfile)
+	}
+
+	// keep the API endpoint, credential store and login method so the next
+	// login goes to the same place the same way, and the aliases, which
+	// are not part of the login
+	updateConfig(func(config *Config) error {
+		*config = Config{ApiUrl: config.ApiUrl, CredentialStore: config.CredentialStore, Login: config.Login, Aliases: config.Aliases}
+		return nil
+	})
 
 	if err != nil {
-		fmt.Println("Error deleting authorization token.  You will need to do that manually from the MongoHQ UI.")
-	} else {
-		fmt.Println("Logout successful.")
+		return fmt.Errorf("Error deleting authorization token.  You will need to do that manually from the MongoHQ UI.")
 	}
+	fmt.Fprintln(c.Out, "Logout successful.")
+	return nil
 }
 
-func (c *LoginController) verifyAuth() {
-	_, err := c.readCredentialFile()
-	if err != nil {
-		err := c.login()
+// errLoginRequired stops commands that would otherwise wait on a login
+// prompt nobody can answer, as on a CI runner.
+var errLoginRequired = errors.New("Not logged in, and not running in a terminal, so cannot prompt for credentials.\nSet MONGOHQ_API_TOKEN or pass --token, or log in by running a mongohq command from a terminal.")
+
+func (c *LoginController) verifyAuth() error {
+	if c.OauthToken != "" {
+		c.Api.SetToken(c.OauthToken)
+		c.Api.AccountSlug = c.accountSlug()
+		return nil
+	}
+
+	err := c.readCredentials()
+	if err != nil && err != errNoCredentials {
+		return err
+	} else if err != nil {
+		if !isInteractive() {
+			return errLoginRequired
+		}
+
+		err := c.login(getConfig().Login)
 
 		if err != nil {
-			fmt.Println("\n" + err.Error() + "\n")
-			os.Exit(1)
+			return fmt.Errorf("\n%w\n", err)
 		}
 	}
 
-	c.Api.Config = getConfig()
+	c.Api.AccountSlug = c.accountSlug()
+	return nil
+}
+
+func (c *LoginController) accountSlug() string {
+	if c.Account != "" {
+		return c.Account
+	}
+	return configValue("account")
+}
+
+// MigrateCredentials moves the profile's stored credentials into another
+// store, such as from the original plaintext file into the Secret Service.
+func (c *LoginController) MigrateCredentials(to string) error {
+	if to == "" {
+		to = defaultCredentialStore()
+	}
+	target, err := credentialStoreFor(to)
+	if err != nil {
+		return err
+	}
+
+	from := savedCredentialStore()
+	if from == to {
+		fmt.Fprintln(c.Out, "Credentials for profile "+activeProfile+" are already in the "+to+" store.")
+		return nil
+	}
+	source, err := credentialStoreFor(from)
+	if err != nil {
+		return err
+	}
+
+	creds, err := source.Load(activeProfile)
+	if err == errNoCredentials {
+		return errors.New("Profile " + activeProfile + " has no stored credentials to migrate.")
+	} else if err != nil {
+		return err
+	}
+
+	if err := target.Save(activeProfile, creds); err != nil {
+		return err
+	}
+
+	err = updateConfig(func(config *Config) error {
+		config.CredentialStore = to
+		config.Email = creds.Email
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Error recording credential store: %w", err)
+	}
+
+	if err := source.Delete(activeProfile); err != nil {
+		return fmt.Errorf("Credentials were copied to the %s store, but removing them from the %s store failed: %w", to, from, err)
+	}
+
+	fmt.Fprintln(c.Out, "Moved credentials for profile "+activeProfile+" from the "+from+" store to the "+to+" store.")
+	return nil
 }
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/MongoHQ/mongohq-cli/mongohq"
+	"github.com/MongoHQ/mongohq-cli/mongohq/mongohqtest"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newExpiringLogin logs the profile in with a device login whose token,
+// unlike the server's own, can be revoked while a command runs.  It
+// returns the authorization id the token belongs to.
+func newExpiringLogin(t *testing.T, accounts int) (*mongohqtest.Server, string) {
+	server := newTestServer(t)
+	server.DevicePendingPolls = 0
+	os.Unsetenv("MONGOHQ_API_TOKEN")
+	for i := 1; i < accounts; i++ {
+		slug := fmt.Sprintf("account-%d", i)
+		server.Accounts = append(server.Accounts, mongohq.Account{Id: slug, Name: slug, Slug: slug, Active: true})
+		server.Deployments[slug] = []mongohq.Deployment{
+			{Id: slug, Name: slug + "-deployment", Plan: "elastic", Location: "aws:us-east-1", Status: "running", Version: "2.6.3"},
+		}
+	}
+
+	authorization, err := server.Api().CreateAuthorization(context.Background(), "expiring")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (plaintextStore{}).Save(defaultProfile, credentials{Email: "user@example.com", OauthToken: authorization.Token}); err != nil {
+		t.Fatal(err)
+	}
+	if err := updateConfig(func(config *Config) error {
+		config.CredentialStore = storePlaintext
+		config.Email = "user@example.com"
+		config.Login = loginDevice
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return server, authorization.Id
+}
+
+// TestReauthenticateOnce has every account's listing rejected at once,
+// and expects a single login to carry all of them.
+func TestReauthenticateOnce(t *testing.T) {
+	const accounts = 5
+	server, authorizationId := newExpiringLogin(t, accounts)
+
+	defer func(terminal func() bool) { stdinIsTerminal = terminal }(stdinIsTerminal)
+	stdinIsTerminal = func() bool { return true }
+
+	// hold the listings until all of them are in flight, then revoke the
+	// token they carry
+	var arrived sync.WaitGroup
+	arrived.Add(accounts)
+	release := make(chan struct{})
+	go func() {
+		arrived.Wait()
+		server.Api().RevokeAuthorization(context.Background(), authorizationId)
+		close(release)
+	}()
+	var held sync.Map
+	handler := server.Config.Handler
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/deployments") {
+			if _, seen := held.LoadOrStore(r.URL.Path, true); !seen {
+				arrived.Done()
+				select {
+				case <-release:
+				case <-time.After(10 * time.Second):
+					t.Error("the listings were not all sent at once")
+				}
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+
+	r := runCommand(t, "deployments", "--all-accounts", "--columns", "account,name")
+	if r.status != 0 {
+		t.Fatalf("exited %d: %s", r.status, r.stderr)
+	}
+	if got := strings.Count(r.stdout, "Your MongoHQ login has expired or been revoked"); got != 1 {
+		t.Errorf("asked to log in again %d times for %d rejected requests:\n%s", got, accounts, r.stdout)
+	}
+	for i := 1; i < accounts; i++ {
+		if name := fmt.Sprintf("account-%d-deployment", i); !strings.Contains(r.stdout, name) {
+			t.Errorf("%s is missing from the listing:\n%s", name, r.stdout)
+		}
+	}
+
+	if creds, err := (plaintextStore{}).Load(defaultProfile); err != nil || creds.OauthToken != server.Token {
+		t.Errorf("stored %+v, %v after logging in again, want the new token", creds, err)
+	}
+}
+
+func TestReauthenticateWithoutTerminal(t *testing.T) {
+	server, authorizationId := newExpiringLogin(t, 1)
+	if err := server.Api().RevokeAuthorization(context.Background(), authorizationId); err != nil {
+		t.Fatal(err)
+	}
+
+	r := runCommand(t, "deployments")
+	if r.status != 7 {
+		t.Errorf("exited %d, want 7: %s", r.status, r.stderr)
+	}
+	if strings.Contains(r.stdout, "Your MongoHQ login has expired") {
+		t.Errorf("prompted without a terminal:\n%s", r.stdout)
+	}
+	for _, request := range server.Requests {
+		if request == "POST /oauth/device/code" {
+			t.Error("started a device login without a terminal")
+		}
+	}
+}
+
+func TestLogoutWithRevokedToken(t *testing.T) {
+	server, authorizationId := newExpiringLogin(t, 1)
+	if err := server.Api().RevokeAuthorization(context.Background(), authorizationId); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(terminal func() bool) { stdinIsTerminal = terminal }(stdinIsTerminal)
+	stdinIsTerminal = func() bool { return true }
+
+	runCommand(t, "logout")
+	for _, request := range server.Requests {
+		if strings.HasPrefix(request, "POST /oauth/") {
+			t.Errorf("logout sent %s, logging in again", request)
+		}
+	}
+	if _, err := (plaintextStore{}).Load(defaultProfile); err != errNoCredentials {
+		t.Errorf("credentials are still stored after logout: %v", err)
+	}
+}
+
+// TestLoginRejectedDuringLogin has the server reject the token a device
+// login was just given, which fails the login rather than starting
+// another.
+func TestLoginRejectedDuringLogin(t *testing.T) {
+	server := newTestServer(t)
+	server.DevicePendingPolls = 0
+	os.Unsetenv("MONGOHQ_API_TOKEN")
+	server.Fail = map[string]int{"GET /user": http.StatusUnauthorized}
+
+	defer func(terminal func() bool) { stdinIsTerminal = terminal }(stdinIsTerminal)
+	stdinIsTerminal = func() bool { return true }
+
+	r := runCommand(t, "login", "--device")
+	if r.status == 0 {
+		t.Errorf("login succeeded with its token rejected:\n%s", r.stdout)
+	}
+	if strings.Contains(r.stdout, "Your MongoHQ login has expired") {
+		t.Errorf("started another login inside the first:\n%s", r.stdout)
+	}
+	deviceLogins := 0
+	for _, request := range server.Requests {
+		if request == "POST /oauth/device/code" {
+			deviceLogins++
+		}
+	}
+	if deviceLogins != 1 {
+		t.Errorf("started %d device logins, want 1", deviceLogins)
+	}
+}
@@ -2,12 +2,13 @@ package main
 
 import (
 	"fmt"
-	"os"
+	"github.com/MongoHQ/mongohq-cli/mongohq"
+	"io"
 	"strconv"
 	"time"
 )
 
-func (c *Controller) HistoricalLogs(deploymentSlug, search, exclude, regexp string) {
+func (c *Controller) HistoricalLogs(deploymentSlug, search, exclude, regexp string) error {
 	logLimit := 200
 
 	var first time.Time
@@ -16,44 +17,48 @@ func (c *Controller) HistoricalLogs(deploymentSlug, search, exclude, regexp stri
 	var command string
 
 	for command != "exit" && command != "e" {
-		var historicalLogs []HistoricalLog
+		var historicalLogs []mongohq.HistoricalLog
 		var hostLength int
 		var err error
 
 		if command == "n" || command == "next" {
-			historicalLogs, hostLength, err = c.Api.GetHistoricalLogs(deploymentSlug, search, exclude, regexp, logLimit, &last, nil)
+			historicalLogs, hostLength, err = c.Api.GetHistoricalLogs(c.Context, deploymentSlug, search, exclude, regexp, logLimit, &last, nil)
 		} else if command == "p" || command == "previous" {
-			historicalLogs, hostLength, err = c.Api.GetHistoricalLogs(deploymentSlug, search, exclude, regexp, logLimit, nil, &first)
+			historicalLogs, hostLength, err = c.Api.GetHistoricalLogs(c.Context, deploymentSlug, search, exclude, regexp, logLimit, nil, &first)
 		} else if command == "" {
-			historicalLogs, hostLength, err = c.Api.GetHistoricalLogs(deploymentSlug, search, exclude, regexp, logLimit, nil, nil)
+			historicalLogs, hostLength, err = c.Api.GetHistoricalLogs(c.Context, deploymentSlug, search, exclude, regexp, logLimit, nil, nil)
 		} else {
-			fmt.Print(command + " is an unknown option.  Please type (n)ext, (p)revious, or (e)xit.")
+			fmt.Fprint(c.Out, command+" is an unknown option.  Please type (n)ext, (p)revious, or (e)xit.")
 			command = prompt("(n)ext (p)revious (e)xit >")
 			continue
 		}
 
 		if err != nil {
-			fmt.Println("Error retrieving logs: " + err.Error())
-			os.Exit(1)
+			return fmt.Errorf("Error retrieving logs: %w", err)
 		} else {
 			if len(historicalLogs) == 0 {
-				fmt.Println("No logs matching query.")
+				fmt.Fprintln(c.Out, "No logs matching query.")
 			} else {
-				first, last = renderLogs(historicalLogs, hostLength)
+				first, last = renderLogs(c.Out, historicalLogs, hostLength)
 			}
 		}
 
+		// with no one to page through them, the first page is all
+		if !isInteractive() {
+			return nil
+		}
 		command = prompt("(n)ext (p)revious (e)xit >")
 	}
+	return nil
 }
 
-func renderLogs(historicalLogs []HistoricalLog, hostLength int) (time.Time, time.Time) {
-	var last HistoricalLog
+func renderLogs(out io.Writer, historicalLogs []mongohq.HistoricalLog, hostLength int) (time.Time, time.Time) {
+	var last mongohq.HistoricalLog
 
 	first := historicalLogs[0]
 	for _, log := range historicalLogs {
 		last = log
-		fmt.Println(fmt.Sprintf("%-"+strconv.Itoa(hostLength+2)+"s%s", formatHostname(log.Host), log.Message))
+		fmt.Fprintln(out, fmt.Sprintf("%-"+strconv.Itoa(hostLength+2)+"s%s", mongohq.FormatHostname(log.Host), log.Message))
 	}
 
 	return first.Timestamp.Add(time.Millisecond * -1), last.Timestamp.Add(time.Millisecond)
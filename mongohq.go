@@ -1,24 +1,66 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"github.com/MongoHQ/mongohq-cli/mongohq"
 	"github.com/codegangsta/cli"
 	"os"
 )
 
-var api *Api
+var api *mongohq.Api
 var controller Controller
-var historyfn = os.Getenv("HOME") + "/.mongohq/history"
+var loginController = new(LoginController)
+
+// apiRequests bounds the API requests a command makes at once, such as
+// for deployment details or with --all-accounts, however many accounts
+// and deployments there are.
+var apiRequests = make(chan struct{}, 8)
 
 func main() {
-	loginController := new(LoginController)
+	initPaths()
+	cli.HelpPrinter = printHelpWithAliases(cli.HelpPrinter)
+	handleInterrupts()
+	runApp(newApp(), os.Args)
+}
+
+// runApp expands aliases and MONGOHQ_* variables in args, then runs the
+// command they name.
+func runApp(app *cli.App, args []string) {
+	args, err := applyEnvironment(app, expandAlias(app, args, commandAliases()))
+	if err != nil {
+		reportError(err)
+		return
+	}
+	app.Run(args)
+}
 
+// newApp describes the global flags and every command.
+func newApp() *cli.App {
 	app := cli.NewApp()
 	app.Name = "mongohq"
 	app.Usage = "Allow MongoHQ interaction from the commandline (enables awesomeness)"
+	app.Flags = []cli.Flag{
+		cli.StringFlag{Name: "api-url", Value: "", Usage: "MongoHQ API endpoint; defaults to $MONGOHQ_API_URL, then config:api-url, then " + mongohq.DefaultApiUrl},
+		cli.StringFlag{Name: "account,a", Value: "", Usage: "account slug to use for this command instead of the default (or set MONGOHQ_ACCOUNT)"},
+		cli.StringFlag{Name: "profile", Value: "", Usage: "credentials and defaults to use, from profiles:list (or set MONGOHQ_PROFILE)"},
+		cli.StringFlag{Name: "token", Value: "", Usage: "API token to use instead of the stored credentials (or set MONGOHQ_API_TOKEN or MONGOHQ_TOKEN)"},
+		cli.StringFlag{Name: "otp", Value: "", Usage: "2fa code to log in with instead of prompting, such as from an authenticator app (or set MONGOHQ_OTP)"},
+		cli.StringFlag{Name: "credential-store", Value: "", Usage: "where logins keep their token: secret-service, encrypted-file or plaintext (or set MONGOHQ_CREDENTIAL_STORE)"},
+		cli.IntFlag{Name: "retries", Value: 0, Usage: "maximum attempts per API request (default 3, or $MONGOHQ_RETRIES)"},
+		cli.StringFlag{Name: "retry-backoff", Value: "", Usage: "initial delay between attempts, doubled each retry (default 500ms, or $MONGOHQ_RETRY_BACKOFF)"},
+		cli.BoolFlag{Name: "retry-non-idempotent", Usage: "also retry POST and PATCH requests after network errors and 5xx responses"},
+		cli.BoolFlag{Name: "verbose", Usage: "trace API requests and websocket frames to stderr (or set MONGOHQ_VERBOSE=true)"},
+		cli.StringFlag{Name: "trace-file", Value: "", Usage: "append traces to a file instead of stderr (or set MONGOHQ_TRACE_FILE)"},
+		cli.StringFlag{Name: "format", Value: "", Usage: "output for listings and details: text (default), json, yaml or table"},
+		cli.StringFlag{Name: "template", Value: "", Usage: "render listings and details with a Go text/template, such as '{{range .}}{{.Name}}{{\"\\n\"}}{{end}}'"},
+		cli.StringFlag{Name: "timeout", Value: "", Usage: "give up on a command after this long, such as 30s or 5m (or set MONGOHQ_TIMEOUT)"},
+	}
 	app.Before = func(c *cli.Context) error {
-		loginController.Api = &Api{UserAgent: "MongoHQ-CLI " + Version()}
-		controller = Controller{Api: loginController.Api}
+		if err := setupCommand(c); err != nil {
+			reportError(err)
+			return err
+		}
 		return nil
 	}
 	app.CommandNotFound = findClosestCommand
@@ -33,15 +75,17 @@ func main() {
 			Description: `
 List the slugs for all accounts which you have permission To change the default account, see the "config:account" command.
       `,
-			Action: func(c *cli.Context) {
-				loginController.RequireAuth()
+			Action: run(func(c *cli.Context) error {
+				if err := loginController.RequireAuth(); err != nil {
+					return err
+				}
 
 				if c.String("account") == "<string>" {
-					controller.ListAccounts()
+					return controller.ListAccounts()
 				} else {
-					controller.ShowAccount(c.String("account"))
+					return controller.ShowAccount(c.String("account"))
 				}
-			},
+			}),
 		},
 		{
 			Name:  "accounts:info",
@@ -54,15 +98,68 @@ More detail about a particular account, including name, slug, owner, and account
 
 These account users are different than database users, and cannot be used to directly access a database.
       `,
-			Action: func(c *cli.Context) {
-				loginController.RequireAuth()
-				err := requireArguments(c, []string{"account"}, []string{})
-				if err != nil {
-					cliOSExit()
-					return
+			Action: run(func(c *cli.Context) error {
+				if err := loginController.RequireAuth(); err != nil {
+					return err
 				}
-				controller.ShowAccount(c.String("account"))
+				if err := requireArguments(c, []string{"account"}, []string{}); err != nil {
+					return err
+				}
+				return controller.ShowAccount(c.String("account"))
+			}),
+		},
+		{
+			Name:  "aliases",
+			Usage: "list command aliases",
+			Description: `
+Lists your aliases, with the file each comes from.  An alias stands in for the command line it names, followed by any further arguments, so with "prod-stat = mongostat --deployment prod-main", running "mongohq prod-stat" runs "mongohq mongostat --deployment prod-main".
+
+Aliases from aliases:set are shared by every profile.  A project file's aliases, described under config:list, win over them.
+      `,
+			Action: run(func(c *cli.Context) error {
+				return controller.ListAliases()
+			}),
+		},
+		{
+			Name:  "aliases:set",
+			Usage: "add or change a command alias",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "name,n", Value: "<string>", Usage: "alias to run it by"},
+				cli.StringFlag{Name: "command,c", Value: "<string>", Usage: "command line it stands for, without \"mongohq\""},
 			},
+			Description: `
+Saves an alias for a command line, such as:
+
+  mongohq aliases:set --name prod-stat --command "mongostat --deployment prod-main"
+  mongohq aliases:set --name lsdb --command "deployments --format table"
+
+The command line must start with a mongohq command, optionally after global options such as --format.  An alias cannot take the name of a command.
+      `,
+			Action: run(func(c *cli.Context) error {
+				if err := requireArguments(c, []string{"name", "command"}, []string{}); err != nil {
+					return err
+				}
+				if err := validateAlias(app, c.String("name"), c.String("command")); err != nil {
+					return err
+				}
+				return controller.SetAlias(c.String("name"), c.String("command"))
+			}),
+		},
+		{
+			Name:  "aliases:remove",
+			Usage: "remove a command alias",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "name,n", Value: "<string>", Usage: "alias to remove"},
+			},
+			Description: `
+Removes an alias saved with aliases:set.  Aliases from a project file are removed by editing the file.
+      `,
+			Action: run(func(c *cli.Context) error {
+				if err := requireArguments(c, []string{"name"}, []string{}); err != nil {
+					return err
+				}
+				return controller.RemoveAlias(c.String("name"))
+			}),
 		},
 		{
 			Name:  "backups",
@@ -70,6 +167,7 @@ These account users are different than database users, and cannot be used to dir
 			Flags: []cli.Flag{
 				cli.StringFlag{Name: "deployment,dep", Value: "<string>", Usage: "optional deployment filter for backups"},
 				cli.StringFlag{Name: "backup,b", Value: "<string>", Usage: "optional backup name; if included, will run backups:info"},
+				cli.BoolFlag{Name: "all-accounts", Usage: "list the backups of every account you can access"},
 			},
 			Description: `
 Lists the backups associated with your account or deployment.
@@ -77,21 +175,35 @@ Lists the backups associated with your account or deployment.
 To see a list of all backups on your account, including those from deleted deployments, omit the deployment argument.
 
 To see a list of all backups on a single deployment, include the name or id of the intended deployment using the deployment argument.
+
+To see the backups of every account you can access, each marked with its account, use --all-accounts.
       `,
-			Action: func(c *cli.Context) {
-				loginController.RequireAuth()
-				requireAccount(loginController.Api)
+			Action: run(func(c *cli.Context) error {
+				if err := loginController.RequireAuth(); err != nil {
+					return err
+				}
+
+				if c.Bool("all-accounts") {
+					if err := requireAllAccounts(c, "deployment", "backup"); err != nil {
+						return err
+					}
+					return controller.ListBackupsForAllAccounts()
+				}
+
+				if err := controller.RequireAccount(); err != nil {
+					return err
+				}
 
 				if c.String("backup") == "<string>" {
 					if c.String("deployment") == "<string>" {
-						controller.ListBackups()
+						return controller.ListBackups()
 					} else {
-						controller.ListBackupsForDeployment(c.String("deployment"))
+						return controller.ListBackupsForDeployment(c.String("deployment"))
 					}
 				} else {
-					controller.ShowBackup(c.String("backup"))
+					return controller.ShowBackup(c.String("backup"))
 				}
-			},
+			}),
 		},
 		{
 			Name:  "backups:create",
@@ -102,17 +214,19 @@ Queues an on-demand backup for a deployment.  To read more about this feature, s
 			Flags: []cli.Flag{
 				cli.StringFlag{Name: "deployment,dep", Value: "<string>", Usage: "deployment name"},
 			},
-			Action: func(c *cli.Context) {
-				loginController.RequireAuth()
-				requireAccount(loginController.Api)
+			Action: run(func(c *cli.Context) error {
+				if err := loginController.RequireAuth(); err != nil {
+					return err
+				}
+				if err := controller.RequireAccount(); err != nil {
+					return err
+				}
 
-				err := requireArguments(c, []string{"deployment"}, []string{})
-				if err != nil {
-					cliOSExit()
-					return
+				if err := requireArgumentsOrDefaults(c, []string{"deployment"}); err != nil {
+					return err
 				}
-				controller.CreateBackup(c.String("deployment"))
-			},
+				return controller.CreateBackup(argumentOrDefault(c, "deployment"))
+			}),
 		},
 		{
 			Name:  "backups:info",
@@ -123,17 +237,19 @@ Queues an on-demand backup for a deployment.  To read more about this feature, s
 			Description: `
 More detail about a particular backup, including deployment, databases, creation time, type, size, and download link.
       `,
-			Action: func(c *cli.Context) {
-				loginController.RequireAuth()
-				requireAccount(loginController.Api)
+			Action: run(func(c *cli.Context) error {
+				if err := loginController.RequireAuth(); err != nil {
+					return err
+				}
+				if err := controller.RequireAccount(); err != nil {
+					return err
+				}
 
-				err := requireArguments(c, []string{"backup"}, []string{})
-				if err != nil {
-					cliOSExit()
-					return
+				if err := requireArguments(c, []string{"backup"}, []string{}); err != nil {
+					return err
 				}
-				controller.ShowBackup(c.String("backup"))
-			},
+				return controller.ShowBackup(c.String("backup"))
+			}),
 		},
 		{
 			Name:  "backups:restore",
@@ -147,17 +263,19 @@ Restores a backup of a database to a new, fresh deployment. The new deployment w
 				cli.StringFlag{Name: "source-database,source", Value: "<string>", Usage: "original database name"},
 				cli.StringFlag{Name: "destination-database,destination", Value: "<string>", Usage: "new database name"},
 			},
-			Action: func(c *cli.Context) {
-				loginController.RequireAuth()
-				requireAccount(loginController.Api)
+			Action: run(func(c *cli.Context) error {
+				if err := loginController.RequireAuth(); err != nil {
+					return err
+				}
+				if err := controller.RequireAccount(); err != nil {
+					return err
+				}
 
-				err := requireArguments(c, []string{"deployment", "backup", "source-database", "destination-database"}, []string{})
-				if err != nil {
-					cliOSExit()
-					return
+				if err := requireArguments(c, []string{"deployment", "backup", "source-database", "destination-database"}, []string{}); err != nil {
+					return err
 				}
-				controller.RestoreBackup(c.String("backup"), c.String("deployment"), c.String("source-database"), c.String("destination-database"))
-			},
+				return controller.RestoreBackup(c.String("backup"), c.String("deployment"), c.String("source-database"), c.String("destination-database"))
+			}),
 		},
 		{
 			Name:  "config:account",
@@ -168,16 +286,116 @@ Restores a backup of a database to a new, fresh deployment. The new deployment w
 			Description: `
 Set a default account so the account flag is not required for each command.
       `,
-			Action: func(c *cli.Context) {
-				loginController.RequireAuth()
+			Action: run(func(c *cli.Context) error {
+				if err := loginController.RequireAuth(); err != nil {
+					return err
+				}
+
+				if err := requireArguments(c, []string{"account"}, []string{}); err != nil {
+					return err
+				}
+				return controller.SetConfigAccount(c.String("account"))
+			}),
+		},
+		{
+			Name:  "config:api-url",
+			Usage: "set the MongoHQ API endpoint",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "url,u", Value: "<string>", Usage: "API url, such as " + mongohq.DefaultApiUrl},
+			},
+			Description: `
+Point the CLI at a different MongoHQ API, such as a staging environment or a local stand-in.  The websocket endpoint used by mongostat is derived from the same url.
+
+The --api-url flag and the MONGOHQ_API_URL environment variable override this setting for a single command.  To return to the MongoHQ API, set the url back to ` + mongohq.DefaultApiUrl + `.
+      `,
+			Action: run(func(c *cli.Context) error {
+				if err := requireArguments(c, []string{"url"}, []string{}); err != nil {
+					return err
+				}
+				return controller.SetConfigApiUrl(c.String("url"))
+			}),
+		},
+		{
+			Name:  "config:list",
+			Usage: "list config settings",
+			Flags: []cli.Flag{
+				cli.BoolFlag{Name: "show-origin", Usage: "show the file each value comes from"},
+			},
+			Description: `
+Lists every config key and its effective value.  See config:set for what each key does.
 
-				err := requireArguments(c, []string{"account"}, []string{})
-				if err != nil {
-					cliOSExit()
-					return
+Values come from the profile's defaults, overridden by a project file: the nearest .mongohq.json, .mongohq.yml or .mongohq.yaml in the working directory or one of its parents.  A project file may set account, deployment, database, format, color and timeout, and define aliases.
+      `,
+			Action: run(func(c *cli.Context) error {
+				return controller.ListConfig(c.Bool("show-origin"))
+			}),
+		},
+		{
+			Name:  "config:get",
+			Usage: "print a config setting",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "key,k", Value: "<string>", Usage: "config key, from config:list"},
+			},
+			Description: `
+Prints the value of one config key, or an empty line when it is not set.
+      `,
+			Action: run(func(c *cli.Context) error {
+				if err := requireArguments(c, []string{"key"}, []string{}); err != nil {
+					return err
 				}
-				controller.SetConfigAccount(c.String("account"))
+				return controller.GetConfig(c.String("key"))
+			}),
+		},
+		{
+			Name:  "config:set",
+			Usage: "change a config setting",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "key,k", Value: "<string>", Usage: "config key, from config:list"},
+				cli.StringFlag{Name: "value", Value: "<string>", Usage: "new value"},
 			},
+			Description: `
+Sets a default in the current profile.  A project file, described under config:list, overrides these.  The keys are:
+
+  ` + configKeysHelp() + `
+
+Accounts, deployments and databases are checked against the API before they are saved.  Commands that act on an existing deployment or database use the defaults when --deployment or --database is not given; removals, and commands that create a deployment or database, always need the flag.  The default database is only used with the default deployment.
+      `,
+			Action: run(func(c *cli.Context) error {
+				if err := requireArguments(c, []string{"key", "value"}, []string{}); err != nil {
+					return err
+				}
+
+				switch c.String("key") {
+				case "account":
+					if err := loginController.RequireAuth(); err != nil {
+						return err
+					}
+				case "deployment", "database":
+					if err := loginController.RequireAuth(); err != nil {
+						return err
+					}
+					if err := controller.RequireAccount(); err != nil {
+						return err
+					}
+				}
+				return controller.SetConfig(c.String("key"), c.String("value"))
+			}),
+		},
+		{
+			Name:  "config:unset",
+			Usage: "remove a config setting",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "key,k", Value: "<string>", Usage: "config key, from config:list"},
+			},
+			Description: `
+Removes a default, so commands go back to requiring the flag or using the built-in value.  Unsetting the deployment also unsets the database.
+      `,
+			Action: run(func(c *cli.Context) error {
+				if err := requireArguments(c, []string{"key"}, []string{}); err != nil {
+					return err
+				}
+				return controller.UnsetConfig(c.String("key"))
+			}),
 		},
 		{
 			Name:      "databases:create",
@@ -190,17 +408,22 @@ Set a default account so the account flag is not required for each command.
 			Description: `
 Create a new database on an existing deployment.  If you are looking to create a new database on a new deployment, see the deployments:create command.
       `,
-			Action: func(c *cli.Context) {
-				loginController.RequireAuth()
-				requireAccount(loginController.Api)
+			Action: run(func(c *cli.Context) error {
+				if err := loginController.RequireAuth(); err != nil {
+					return err
+				}
+				if err := controller.RequireAccount(); err != nil {
+					return err
+				}
 
-				err := requireArguments(c, []string{"deployment", "database"}, []string{})
-				if err != nil {
-					cliOSExit()
-					return
+				if err := requireArgumentsOrDefaults(c, []string{"deployment"}); err != nil {
+					return err
 				}
-				controller.CreateDatabase(c.String("deployment"), c.String("database"))
-			},
+				if err := requireArguments(c, []string{"database"}, []string{}); err != nil {
+					return err
+				}
+				return controller.CreateDatabase(argumentOrDefault(c, "deployment"), c.String("database"))
+			}),
 		},
 		{
 			Name:      "databases:info",
@@ -213,17 +436,19 @@ Create a new database on an existing deployment.  If you are looking to create a
 			Description: `
 More detail on a particular database, including name, status, and stats.
       `,
-			Action: func(c *cli.Context) {
-				loginController.RequireAuth()
-				requireAccount(loginController.Api)
+			Action: run(func(c *cli.Context) error {
+				if err := loginController.RequireAuth(); err != nil {
+					return err
+				}
+				if err := controller.RequireAccount(); err != nil {
+					return err
+				}
 
-				err := requireArguments(c, []string{"database", "deployment"}, []string{})
-				if err != nil {
-					cliOSExit()
-					return
+				if err := requireArgumentsOrDefaults(c, []string{"database", "deployment"}); err != nil {
+					return err
 				}
-				controller.ShowDatabase(c.String("deployment"), c.String("database"))
-			},
+				return controller.ShowDatabase(argumentOrDefault(c, "deployment"), argumentOrDefault(c, "database"))
+			}),
 		},
 		{
 			Name:      "databases:remove",
@@ -239,38 +464,63 @@ Deletes a database from a deployment.  If this is the last database on the deplo
 
 You will be asked to verify the database name on delete, unless including the force argument.
       `,
-			Action: func(c *cli.Context) {
-				loginController.RequireAuth()
-				requireAccount(loginController.Api)
+			Action: run(func(c *cli.Context) error {
+				if err := loginController.RequireAuth(); err != nil {
+					return err
+				}
+				if err := controller.RequireAccount(); err != nil {
+					return err
+				}
 
-				err := requireArguments(c, []string{"database", "deployment"}, []string{})
-				if err != nil {
-					cliOSExit()
-					return
+				if err := requireArguments(c, []string{"database", "deployment"}, []string{}); err != nil {
+					return err
 				}
-				controller.DeleteDatabase(c.String("deployment"), c.String("database"), c.Bool("force"))
-			},
+				return controller.DeleteDatabase(c.String("deployment"), c.String("database"), c.Bool("force"))
+			}),
 		},
 		{
 			Name:      "deployments",
 			ShortName: "dep",
 			Usage:     "list deployments",
 			Description: `
-List the slugs for all deployments.
+List deployments in a table, with their plan, status, location and version, sorted by name.
+
+Choose the columns with --columns, from ` + deploymentColumnNames() + `, and the order with --sort, such as --sort status, or --sort -version for the newest first.  --status, --plan, --location and --version show only matching deployments, and take several values separated by commas: --status running, --location aws matches every aws: location, and --version 2.6 matches 2.6.3.
+
+To see the deployments of every account you can access, each marked with its account, use --all-accounts.
       `,
 			Flags: []cli.Flag{
 				cli.StringFlag{Name: "deployment,dep", Value: "<string>", Usage: "optional deployment name; if included runs deployments:info"},
+				cli.BoolFlag{Name: "all-accounts", Usage: "list the deployments of every account you can access"},
+				cli.StringFlag{Name: "columns", Value: "", Usage: "comma separated columns to show (default " + defaultDeploymentColumns + ")"},
+				cli.StringFlag{Name: "sort", Value: "", Usage: "column to sort by, reversed with a leading -, such as -version"},
+				cli.StringFlag{Name: "status", Value: "", Usage: "only deployments with this status, such as running"},
+				cli.StringFlag{Name: "plan", Value: "", Usage: "only deployments on this plan"},
+				cli.StringFlag{Name: "location", Value: "", Usage: "only deployments in this location, such as aws:us-east-1 or aws"},
+				cli.StringFlag{Name: "version", Value: "", Usage: "only deployments on this MongoDB version, such as 2.6"},
 			},
-			Action: func(c *cli.Context) {
-				loginController.RequireAuth()
-				requireAccount(loginController.Api)
+			Action: run(func(c *cli.Context) error {
+				if err := loginController.RequireAuth(); err != nil {
+					return err
+				}
+
+				if c.Bool("all-accounts") {
+					if err := requireAllAccounts(c, "deployment"); err != nil {
+						return err
+					}
+					return controller.ListDeploymentsForAllAccounts(deploymentListing(c))
+				}
+
+				if err := controller.RequireAccount(); err != nil {
+					return err
+				}
 
 				if c.String("deployment") == "<string>" {
-					controller.ListDeployments()
+					return controller.ListDeployments(deploymentListing(c))
 				} else {
-					controller.ShowDeployment(c.String("deployment"))
+					return controller.ShowDeployment(c.String("deployment"))
 				}
-			},
+			}),
 		},
 		{
 			Name:      "deployments:create",
@@ -284,17 +534,19 @@ List the slugs for all deployments.
 			Description: `
 Creates an elastic deployment on the MongoHQ platform. Stick with me here: it will create a new database on a new deployment at location you specify.  The deployment is a Replica Set and the database is the logical MongoDB database. You can find a list of locations by running "mongohq locations".
       `,
-			Action: func(c *cli.Context) {
-				loginController.RequireAuth()
-				requireAccount(loginController.Api)
+			Action: run(func(c *cli.Context) error {
+				if err := loginController.RequireAuth(); err != nil {
+					return err
+				}
+				if err := controller.RequireAccount(); err != nil {
+					return err
+				}
 
-				err := requireArguments(c, []string{"deployment", "database", "location"}, []string{})
-				if err != nil {
-					cliOSExit()
-					return
+				if err := requireArguments(c, []string{"deployment", "database", "location"}, []string{}); err != nil {
+					return err
 				}
-				controller.CreateDeployment(c.String("deployment"), c.String("database"), c.String("location"))
-			},
+				return controller.CreateDeployment(c.String("deployment"), c.String("database"), c.String("location"))
+			}),
 		},
 		{
 			Name:      "deployments:info",
@@ -306,17 +558,19 @@ Creates an elastic deployment on the MongoHQ platform. Stick with me here: it wi
 			Description: `
 More detail about a particular deployment, including plan, status, location, current primary, members, version, and a list of databases.
       `,
-			Action: func(c *cli.Context) {
-				loginController.RequireAuth()
-				requireAccount(loginController.Api)
+			Action: run(func(c *cli.Context) error {
+				if err := loginController.RequireAuth(); err != nil {
+					return err
+				}
+				if err := controller.RequireAccount(); err != nil {
+					return err
+				}
 
-				err := requireArguments(c, []string{"deployment"}, []string{})
-				if err != nil {
-					cliOSExit()
-					return
+				if err := requireArgumentsOrDefaults(c, []string{"deployment"}); err != nil {
+					return err
 				}
-				controller.ShowDeployment(c.String("deployment"))
-			},
+				return controller.ShowDeployment(argumentOrDefault(c, "deployment"))
+			}),
 		},
 		{
 			Name:      "deployments:rename",
@@ -331,17 +585,22 @@ Sometime, you want a little more description about a deployment than an hex id.
 
 Immediately after making this change, you will need to reference the deployment by the new name.
       `,
-			Action: func(c *cli.Context) {
-				loginController.RequireAuth()
-				requireAccount(loginController.Api)
+			Action: run(func(c *cli.Context) error {
+				if err := loginController.RequireAuth(); err != nil {
+					return err
+				}
+				if err := controller.RequireAccount(); err != nil {
+					return err
+				}
 
-				err := requireArguments(c, []string{"deployment", "name"}, []string{})
-				if err != nil {
-					cliOSExit()
-					return
+				if err := requireArgumentsOrDefaults(c, []string{"deployment"}); err != nil {
+					return err
 				}
-				controller.RenameDeployment(c.String("deployment"), c.String("name"))
-			},
+				if err := requireArguments(c, []string{"name"}, []string{}); err != nil {
+					return err
+				}
+				return controller.RenameDeployment(argumentOrDefault(c, "deployment"), c.String("name"))
+			}),
 		},
 		{
 			Name:      "deployments:remove",
@@ -354,17 +613,19 @@ Immediately after making this change, you will need to reference the deployment
 			Description: `
 Deletes a deployment.  Requires confirmation because this is a very destructive action, particularly for data.
       `,
-			Action: func(c *cli.Context) {
-				loginController.RequireAuth()
-				requireAccount(loginController.Api)
+			Action: run(func(c *cli.Context) error {
+				if err := loginController.RequireAuth(); err != nil {
+					return err
+				}
+				if err := controller.RequireAccount(); err != nil {
+					return err
+				}
 
-				err := requireArguments(c, []string{"deployment"}, []string{})
-				if err != nil {
-					cliOSExit()
-					return
+				if err := requireArguments(c, []string{"deployment"}, []string{}); err != nil {
+					return err
 				}
-				controller.DeleteDeployment(c.String("deployment"), c.Bool("force"))
-			},
+				return controller.DeleteDeployment(c.String("deployment"), c.Bool("force"))
+			}),
 		},
 		{
 			Name:  "logs",
@@ -375,17 +636,19 @@ Deletes a deployment.  Requires confirmation because this is a very destructive
 				cli.StringFlag{Name: "search,s", Value: "<string>", Usage: "exact search term for log searches"},
 				cli.StringFlag{Name: "exclude,v", Value: "<string>", Usage: "exclude search term for log searches"},
 			},
-			Action: func(c *cli.Context) {
-				loginController.RequireAuth()
-				requireAccount(loginController.Api)
+			Action: run(func(c *cli.Context) error {
+				if err := loginController.RequireAuth(); err != nil {
+					return err
+				}
+				if err := controller.RequireAccount(); err != nil {
+					return err
+				}
 
-				err := requireArguments(c, []string{"deployment"}, []string{})
-				if err != nil {
-					cliOSExit()
-					return
+				if err := requireArgumentsOrDefaults(c, []string{"deployment"}); err != nil {
+					return err
 				}
-				controller.HistoricalLogs(c.String("deployment"), c.String("search"), c.String("exclude"), c.String("regexp"))
-			},
+				return controller.HistoricalLogs(argumentOrDefault(c, "deployment"), optionalString(c, "search"), optionalString(c, "exclude"), optionalString(c, "regexp"))
+			}),
 		},
 		{
 			Name:  "locations",
@@ -393,12 +656,16 @@ Deletes a deployment.  Requires confirmation because this is a very destructive
 			Description: `
 List the current locations available for MongoHQ deployments.  Used with both new deployments and restoring databases from backups.
       `,
-			Action: func(c *cli.Context) {
-				loginController.RequireAuth()
-				requireAccount(loginController.Api)
+			Action: run(func(c *cli.Context) error {
+				if err := loginController.RequireAuth(); err != nil {
+					return err
+				}
+				if err := controller.RequireAccount(); err != nil {
+					return err
+				}
 
-				controller.ListLocations()
-			},
+				return controller.ListLocations()
+			}),
 		},
 		{
 			Name:  "mongostat",
@@ -413,17 +680,19 @@ A streaming output of usage statistics for your database.  This is a very good f
  * Memory usage: physical and virtual usage, with page swaps (i.e. faults) / second
  * Database behavior: flushes, locked percentage, queued reads and writes
       `,
-			Action: func(c *cli.Context) {
-				loginController.RequireAuth()
-				requireAccount(loginController.Api)
+			Action: run(func(c *cli.Context) error {
+				if err := loginController.RequireAuth(); err != nil {
+					return err
+				}
+				if err := controller.RequireAccount(); err != nil {
+					return err
+				}
 
-				err := requireArguments(c, []string{"deployment"}, []string{})
-				if err != nil {
-					cliOSExit()
-					return
+				if err := requireArgumentsOrDefaults(c, []string{"deployment"}); err != nil {
+					return err
 				}
-				controller.DeploymentMongoStat(c.String("deployment"))
-			},
+				return controller.DeploymentMongoStat(argumentOrDefault(c, "deployment"))
+			}),
 		},
 		{
 			Name:  "users",
@@ -437,17 +706,19 @@ List a databases' users.  These users are used to authenticate against a databas
 
 These are different than account users, which are used to authentication against the MongoHQ service.
       `,
-			Action: func(c *cli.Context) {
-				loginController.RequireAuth()
-				requireAccount(loginController.Api)
+			Action: run(func(c *cli.Context) error {
+				if err := loginController.RequireAuth(); err != nil {
+					return err
+				}
+				if err := controller.RequireAccount(); err != nil {
+					return err
+				}
 
-				err := requireArguments(c, []string{"deployment", "database"}, []string{})
-				if err != nil {
-					cliOSExit()
-					return
+				if err := requireArgumentsOrDefaults(c, []string{"deployment", "database"}); err != nil {
+					return err
 				}
-				controller.ListDatabaseUsers(c.String("deployment"), c.String("database"))
-			},
+				return controller.ListDatabaseUsers(argumentOrDefault(c, "deployment"), argumentOrDefault(c, "database"))
+			}),
 		},
 		{
 			Name:  "users:create",
@@ -463,17 +734,22 @@ Add a new user to a database. With this user, you will be able to authenticate a
 
 If the user already exists, this command will update the password for the user.
       `,
-			Action: func(c *cli.Context) {
-				loginController.RequireAuth()
-				requireAccount(loginController.Api)
+			Action: run(func(c *cli.Context) error {
+				if err := loginController.RequireAuth(); err != nil {
+					return err
+				}
+				if err := controller.RequireAccount(); err != nil {
+					return err
+				}
 
-				err := requireArguments(c, []string{"deployment", "database", "username"}, []string{})
-				if err != nil {
-					cliOSExit()
-					return
+				if err := requireArgumentsOrDefaults(c, []string{"deployment", "database"}); err != nil {
+					return err
 				}
-				controller.CreateDatabaseUser(c.String("deployment"), c.String("database"), c.String("username"), c.String("password"))
-			},
+				if err := requireArguments(c, []string{"username"}, []string{}); err != nil {
+					return err
+				}
+				return controller.CreateDatabaseUser(argumentOrDefault(c, "deployment"), argumentOrDefault(c, "database"), c.String("username"), c.String("password"))
+			}),
 		},
 		{
 			Name:  "users:remove",
@@ -488,17 +764,92 @@ Removes a database user from a database.  If your applications are connecting wi
 
 This user action is against database users used for authentication against a database.  It is different than account users.
       `,
-			Action: func(c *cli.Context) {
-				loginController.RequireAuth()
-				requireAccount(loginController.Api)
+			Action: run(func(c *cli.Context) error {
+				if err := loginController.RequireAuth(); err != nil {
+					return err
+				}
+				if err := controller.RequireAccount(); err != nil {
+					return err
+				}
 
-				err := requireArguments(c, []string{"deployment", "database", "username"}, []string{})
-				if err != nil {
-					cliOSExit()
-					return
+				if err := requireArgumentsOrDefaults(c, []string{"deployment", "database"}); err != nil {
+					return err
 				}
-				controller.DeleteDatabaseUser(c.String("deployment"), c.String("database"), c.String("username"))
+				if err := requireArguments(c, []string{"username"}, []string{}); err != nil {
+					return err
+				}
+				return controller.DeleteDatabaseUser(argumentOrDefault(c, "deployment"), argumentOrDefault(c, "database"), c.String("username"))
+			}),
+		},
+		{
+			Name:  "profiles:list",
+			Usage: "list profiles",
+			Description: `
+List the profiles on this machine, with the user each is logged in as.  Each profile has its own credentials, default account and default deployment.
+
+The active profile is chosen with --profile, then the MONGOHQ_PROFILE environment variable, then profiles:use.
+      `,
+			Action: run(func(c *cli.Context) error {
+				return controller.ListProfiles()
+			}),
+		},
+		{
+			Name:  "profiles:use",
+			Usage: "switch to another profile",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "name,n", Value: "<string>", Usage: "profile to use from now on; a new name creates a profile"},
+			},
+			Description: `
+Make a profile the active one for later commands.  The first command run with a new profile asks for MongoHQ credentials.  Use "default" to return to the original profile.
+      `,
+			Action: run(func(c *cli.Context) error {
+				if err := requireArguments(c, []string{"name"}, []string{}); err != nil {
+					return err
+				}
+				return controller.UseProfile(c.String("name"))
+			}),
+		},
+		{
+			Name:  "profiles:remove",
+			Usage: "remove a profile",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "name,n", Value: "<string>", Usage: "profile to remove"},
+			},
+			Description: `
+Remove a profile's stored credentials and defaults from this machine.  This does not revoke its token; to do that as well, run "mongohq --profile <name> logout" first.
+      `,
+			Action: run(func(c *cli.Context) error {
+				if err := requireArguments(c, []string{"name"}, []string{}); err != nil {
+					return err
+				}
+				return controller.RemoveProfile(c.String("name"))
+			}),
+		},
+		{
+			Name:  "login",
+			Usage: "log in to MongoHQ",
+			Description: `
+Logs in and stores the token for later commands, replacing any existing login for the profile.  Without flags, prompts for your email and password.  With --web, opens your browser to log in, which works with single sign-on; with --device, prints a code to enter from a browser on any other device.  Later logins, such as when the token expires, use the same method.
+      `,
+			Flags: []cli.Flag{
+				cli.BoolFlag{Name: "web", Usage: "log in through your browser"},
+				cli.BoolFlag{Name: "device", Usage: "log in by entering a code from a browser on another device"},
 			},
+			Action: run(func(c *cli.Context) error {
+				method := loginPassword
+				if c.Bool("web") && c.Bool("device") {
+					return errors.New("Use only one of --web and --device.")
+				} else if c.Bool("web") {
+					method = loginWeb
+				} else if c.Bool("device") {
+					method = loginDevice
+				}
+
+				if !isInteractive() {
+					return errLoginRequired
+				}
+				return loginController.login(method)
+			}),
 		},
 		{
 			Name:  "whoami",
@@ -506,11 +857,13 @@ This user action is against database users used for authentication against a dat
 			Description: `
 Just a simple command to tell you which account user you are currently acting as.
       `,
-			Action: func(c *cli.Context) {
-				loginController.RequireAuth()
+			Action: run(func(c *cli.Context) error {
+				if err := loginController.RequireAuth(); err != nil {
+					return err
+				}
 
-				controller.CurrentUser()
-			},
+				return controller.CurrentUser()
+			}),
 		},
 		{
 			Name:  "logout",
@@ -518,9 +871,78 @@ Just a simple command to tell you which account user you are currently acting as
 			Description: `
 Removes authentication information from the MongoHQ CLI on this machine, and sends a kill command to the oauth token used for authentication.
       `,
-			Action: func(c *cli.Context) {
-				loginController.Logout()
+			Action: run(func(c *cli.Context) error {
+				return loginController.Logout()
+			}),
+		},
+		{
+			Name:  "auth:tokens",
+			Usage: "list OAuth tokens issued to you",
+			Description: `
+List the OAuth tokens issued to your user, with the client each was issued to, when it was created and when it was last used.  The token this CLI is using is marked current.
+      `,
+			Action: run(func(c *cli.Context) error {
+				if err := loginController.RequireAuth(); err != nil {
+					return err
+				}
+
+				return controller.ListAuthorizations()
+			}),
+		},
+		{
+			Name:  "auth:create",
+			Usage: "create a long-lived token, such as for CI",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "description,d", Value: "<string>", Usage: "what the token is for, shown by auth:tokens"},
+			},
+			Description: `
+Create a long-lived OAuth token, for use with MONGOHQ_API_TOKEN or --token.  The token is printed once and cannot be shown again.
+      `,
+			Action: run(func(c *cli.Context) error {
+				if err := loginController.RequireAuth(); err != nil {
+					return err
+				}
+
+				if err := requireArguments(c, []string{"description"}, []string{}); err != nil {
+					return err
+				}
+				return controller.CreateAuthorization(c.String("description"))
+			}),
+		},
+		{
+			Name:  "auth:revoke",
+			Usage: "revoke an OAuth token",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "id", Value: "<string>", Usage: "token id, from auth:tokens"},
+			},
+			Description: `
+Revoke one of your OAuth tokens, such as an old CI token when rotating them.  Revoking the token this CLI is using has the same effect as logout, but leaves the stored credentials in place.
+      `,
+			Action: run(func(c *cli.Context) error {
+				if err := loginController.RequireAuth(); err != nil {
+					return err
+				}
+
+				if err := requireArguments(c, []string{"id"}, []string{}); err != nil {
+					return err
+				}
+				return controller.RevokeAuthorization(c.String("id"))
+			}),
+		},
+		{
+			Name:  "credentials:migrate",
+			Usage: "move the stored token to another credential store",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "to,t", Value: "", Usage: "secret-service, encrypted-file or plaintext; defaults to the Secret Service where available, otherwise an encrypted file"},
 			},
+			Description: `
+Move the active profile's stored token, such as one in the original plaintext credentials file, into another credential store.  Later commands use the new store.
+
+The encrypted-file store asks for a passphrase, or reads it from the MONGOHQ_CREDENTIAL_PASSPHRASE environment variable.
+      `,
+			Action: run(func(c *cli.Context) error {
+				return loginController.MigrateCredentials(c.String("to"))
+			}),
 		},
 		{
 			Name:  "update",
@@ -530,22 +952,101 @@ To update, run:
 
   curl https://mongohq-cli.s3.amazonaws.com/install.sh | sh
       `,
-			Action: func(c *cli.Context) {
+			Action: run(func(c *cli.Context) error {
 				fmt.Println("To update, run: `curl https://mongohq-cli.s3.amazonaws.com/install.sh | sh`")
-			},
+				return nil
+			}),
 		},
 		{
 			Name:  "shell",
 			Usage: "starts REPL shell",
 			Description: `Starts a command line shell for the MongoHQ CLI
 				`,
-			Action: func(c *cli.Context) {
-				loginController.Api = &Api{UserAgent: "MongoHQ-CLI " + Version()}
-				controller = Controller{Api: loginController.Api}
-				loginController.RequireAuth()
+			Action: run(func(c *cli.Context) error {
+				if err := loginController.RequireAuth(); err != nil {
+					return err
+				}
 				repl(app)
-			},
+				return nil
+			}),
 		},
 	}
-	app.Run(os.Args)
+	return app
+}
+
+// setupCommand builds the API client and controllers from the global flags
+// before each command, including each line typed in the shell.
+func setupCommand(c *cli.Context) error {
+	profile, err := profileSetting(c)
+	if err != nil {
+		return err
+	}
+	useProfile(profile)
+
+	// a defaults file that cannot be read is reported, rather than
+	// treated as empty and overwritten by the next change
+	for _, path := range []string{configFile, aliasFile} {
+		if _, err := loadConfig(path); err != nil {
+			return err
+		}
+	}
+
+	projectConfig, err = findProjectConfig()
+	if err != nil {
+		return err
+	}
+
+	colorErrors, err = colorSetting(configValue("color"))
+	if err != nil {
+		return err
+	}
+
+	apiUrl := apiUrlSetting(c)
+	if err := mongohq.ValidateApiUrl(apiUrl); err != nil {
+		return err
+	}
+
+	retryPolicy, err := retryPolicySetting(c)
+	if err != nil {
+		return err
+	}
+
+	tracer, err := tracerSetting(c)
+	if err != nil {
+		return err
+	}
+
+	timeout, err := timeoutSetting(c)
+	if err != nil {
+		return err
+	}
+
+	credentialStore, err := credentialStoreSetting(c)
+	if err != nil {
+		return err
+	}
+
+	// --format overrides MONGOHQ_TEMPLATE, and a template replaces the
+	// default format
+	formatName, templateText := c.GlobalString("format"), c.GlobalString("template")
+	if formatName == "" && templateText == "" {
+		templateText = os.Getenv("MONGOHQ_TEMPLATE")
+	}
+	if formatName == "" && templateText == "" {
+		formatName = configValue("format")
+	}
+	format, outputTemplate, err := formatSetting(formatName, templateText)
+	if err != nil {
+		return err
+	}
+
+	loginController.Api = &mongohq.Api{UserAgent: "MongoHQ-CLI " + Version(), ClientId: oauth_client_id, BaseUrl: apiUrl, Retry: retryPolicy, Trace: tracer, Reauthenticate: loginController.reauthenticate, Requests: apiRequests}
+	loginController.Context = startCommand(timeout)
+	loginController.Out = os.Stdout
+	loginController.Account = c.GlobalString("account")
+	loginController.OauthToken = tokenSetting(c)
+	loginController.Otp = otpSetting(c)
+	loginController.Store = credentialStore
+	controller = Controller{Api: loginController.Api, Context: loginController.Context, Out: os.Stdout, Err: os.Stderr, Format: format, Template: outputTemplate}
+	return nil
 }
@@ -1,6 +1,7 @@
-package main
+package mongohq
 
 import (
+	"context"
 	"encoding/json"
 )
 
@@ -16,8 +17,8 @@ type Account struct {
 	Users      []User `json:"users"`
 }
 
-func (api *Api) GetAccounts() ([]Account, error) {
-	body, err := api.restGet(api.apiUrl("/accounts"))
+func (api *Api) GetAccounts(ctx context.Context) ([]Account, error) {
+	body, err := api.restGet(ctx, api.apiUrl("/accounts"))
 
 	if err != nil {
 		return []Account{}, err
@@ -27,8 +28,8 @@ func (api *Api) GetAccounts() ([]Account, error) {
 	return accountsSlice, err
 }
 
-func (api *Api) GetAccount(slug string) (Account, error) {
-	body, err := api.restGet(api.apiUrl("/accounts/" + slug))
+func (api *Api) GetAccount(ctx context.Context, slug string) (Account, error) {
+	body, err := api.restGet(ctx, api.apiUrl("/accounts/"+slug))
 
 	if err != nil {
 		return Account{}, err
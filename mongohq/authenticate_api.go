@@ -0,0 +1,136 @@
+package mongohq
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type AuthenticationArguments struct {
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	GrantType string `json:"grant_type"`
+	ClientId  string `json:"client_id"`
+}
+
+// Second-factor methods the API may ask for in the X-Mongohq-Otp header.
+const (
+	OtpSms    = "sms"
+	OtpApp    = "app"
+	OtpBackup = "backup"
+)
+
+// OtpRequiredError is returned by Authenticate when the account needs a
+// second factor.  Methods lists the kinds of code the API accepts, such as
+// OtpApp and OtpBackup.  Rejected is set when a code was sent but was
+// wrong or expired.
+type OtpRequiredError struct {
+	Methods  []string
+	Rejected bool
+}
+
+func (e *OtpRequiredError) Error() string {
+	if e.Rejected {
+		return "2fa token rejected"
+	}
+	return "2fa token required"
+}
+
+// parseOtpHeader reads "required; <method>[, <method>...]".  It returns nil
+// when the header does not ask for a code.
+func parseOtpHeader(header string) []string {
+	parts := strings.SplitN(header, ";", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) != "required" {
+		return nil
+	}
+
+	var methods []string
+	for _, method := range strings.Split(parts[1], ",") {
+		if method = strings.TrimSpace(method); method != "" {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+// Authenticate exchanges an email and password for an oauth token.  token
+// is the second-factor code, if the account has one; without it, such
+// accounts get an *OtpRequiredError.
+func (api Api) Authenticate(ctx context.Context, username, password, token string) (string, error) {
+	data, err := json.Marshal(AuthenticationArguments{Username: username, Password: password, GrantType: "password", ClientId: api.ClientId})
+	if err != nil {
+		return "", errors.New("Error creating MongoHQ authentication request.")
+	}
+
+	client, err := api.buildHttpClient()
+	if err != nil {
+		return "", errors.New("Error building HTTPS transport process.")
+	}
+	request, err := http.NewRequestWithContext(ctx, "POST", api.apiUrl("/oauth/token"), bytes.NewReader(data))
+	if err != nil {
+		return "", errors.New("Error creating MongoHQ authentication request.")
+	}
+
+	if token != "" {
+		request.Header.Add("X-Mongohq-Otp", token)
+	}
+
+	request.Header.Add("User-Agent", api.UserAgent)
+	request.Header.Add("Content-Type", "application/json")
+
+	api.Trace.Request(request)
+	start := time.Now()
+	response, err := client.Do(request)
+	api.Trace.Response(request, response, err, time.Since(start))
+
+	if err != nil {
+		return "", errors.New("Error authenticating against MongoHQ: " + err.Error())
+	}
+
+	responseBody, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return "", errors.New("Error authenticating against MongoHQ: " + err.Error())
+	}
+	api.Trace.Body("<", responseBody)
+
+	if response.StatusCode >= 400 {
+		methods := parseOtpHeader(response.Header.Get("X-Mongohq-Otp"))
+		if len(methods) == 1 && methods[0] == "unconfigured" {
+			return "", errors.New("Account requires 2fa authentication.  Go to https://app.mongohq.com to configure")
+		} else if len(methods) > 0 {
+			return "", &OtpRequiredError{Methods: methods, Rejected: token != ""}
+		} else {
+			var errorResponse ErrorResponse
+			err = json.Unmarshal(responseBody, &errorResponse)
+
+			if err == nil {
+				return "", errors.New(errorResponse.Error)
+			}
+
+			return "", errors.New("Error authenticating against MongoHQ.")
+		}
+	}
+
+	var jsonResponse map[string]interface{}
+	if err := json.Unmarshal(responseBody, &jsonResponse); err != nil {
+		return "", errors.New("Error reading MongoHQ authentication response.")
+	}
+
+	oauthToken, ok := jsonResponse["access_token"].(string)
+	if !ok || oauthToken == "" {
+		return "", errors.New("MongoHQ did not return an access token.")
+	}
+	return oauthToken, nil
+}
+
+// DeleteAuthorization revokes the oauth token the Api is using.
+func (api *Api) DeleteAuthorization(ctx context.Context) error {
+	_, err := api.restDelete(ctx, api.apiUrl("/authorization"))
+	return err
+}
@@ -0,0 +1,56 @@
+package mongohq
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// Authorization is an OAuth token issued to the user.  Current marks the
+// one the request was made with.  Token is only filled in by
+// CreateAuthorization; the API never returns it again.
+type Authorization struct {
+	Id          string `json:"id"`
+	Client      string `json:"client"`
+	Description string `json:"description"`
+	CreatedAt   string `json:"created_at"`
+	LastUsedAt  string `json:"last_used_at"`
+	Current     bool   `json:"current"`
+	Token       string `json:"token,omitempty"`
+}
+
+func (api *Api) GetAuthorizations(ctx context.Context) ([]Authorization, error) {
+	body, err := api.restGet(ctx, api.apiUrl("/authorizations"))
+
+	if err != nil {
+		return nil, err
+	}
+	var authorizations []Authorization
+	err = json.Unmarshal(body, &authorizations)
+	return authorizations, err
+}
+
+// CreateAuthorization mints a long-lived token, such as for CI.
+func (api *Api) CreateAuthorization(ctx context.Context, description string) (Authorization, error) {
+	type AuthorizationCreate struct {
+		Description string `json:"description"`
+	}
+
+	data, err := json.Marshal(AuthorizationCreate{Description: description})
+	if err != nil {
+		return Authorization{}, err
+	}
+
+	body, err := api.restPost(ctx, api.apiUrl("/authorizations"), data)
+
+	if err != nil {
+		return Authorization{}, err
+	}
+	var authorization Authorization
+	err = json.Unmarshal(body, &authorization)
+	return authorization, err
+}
+
+func (api *Api) RevokeAuthorization(ctx context.Context, id string) error {
+	_, err := api.restDelete(ctx, api.apiUrl("/authorizations/"+id))
+	return err
+}
@@ -1,6 +1,7 @@
-package main
+package mongohq
 
 import (
+	"context"
 	"encoding/json"
 )
 
@@ -14,7 +15,6 @@ type Backup struct {
 	Filename       string   `json:"filename"`
 	Size           float64  `json:"size"`
 	Links          []Hateos `json:"links"`
-	Api            Api
 }
 
 func (b *Backup) DownloadLink() string {
@@ -27,11 +27,11 @@ func (b *Backup) DownloadLink() string {
 }
 
 func (b *Backup) PrettySize() string {
-	return prettySize(b.Size)
+	return PrettySize(b.Size)
 }
 
-func (api *Api) GetBackups() ([]Backup, error) {
-	body, err := api.restGet(api.apiUrl("/accounts/" + api.Config.AccountSlug + "/backups"))
+func (api *Api) GetBackups(ctx context.Context) ([]Backup, error) {
+	body, err := api.restGet(ctx, api.apiUrl("/accounts/"+api.AccountSlug+"/backups"))
 
 	if err != nil {
 		return []Backup{}, err
@@ -41,8 +41,8 @@ func (api *Api) GetBackups() ([]Backup, error) {
 	return databaseBackupSlice, err
 }
 
-func (api *Api) GetBackupsForDeployment(deploymentSlug string) ([]Backup, error) {
-	body, err := api.restGet(api.apiUrl("/deployments/" + api.Config.AccountSlug + "/" + deploymentSlug + "/backups"))
+func (api *Api) GetBackupsForDeployment(ctx context.Context, deploymentSlug string) ([]Backup, error) {
+	body, err := api.restGet(ctx, api.apiUrl("/deployments/"+api.AccountSlug+"/"+deploymentSlug+"/backups"))
 
 	if err != nil {
 		return []Backup{}, err
@@ -52,8 +52,8 @@ func (api *Api) GetBackupsForDeployment(deploymentSlug string) ([]Backup, error)
 	return databaseBackupSlice, err
 }
 
-func (api *Api) GetBackup(backupSlug string) (Backup, error) {
-	body, err := api.restGet(api.apiUrl("/accounts/" + api.Config.AccountSlug + "/backups/" + backupSlug))
+func (api *Api) GetBackup(ctx context.Context, backupSlug string) (Backup, error) {
+	body, err := api.restGet(ctx, api.apiUrl("/accounts/"+api.AccountSlug+"/backups/"+backupSlug))
 
 	if err != nil {
 		return Backup{}, err
@@ -63,7 +63,7 @@ func (api *Api) GetBackup(backupSlug string) (Backup, error) {
 	return backup, err
 }
 
-func (api *Api) RestoreBackup(backup Backup, deploymentName, source, destination string) (Deployment, error) {
+func (api *Api) RestoreBackup(ctx context.Context, backup Backup, deploymentName, source, destination string) (Deployment, error) {
 	type RestoreBackupParams struct {
 		Name           string `json:"name"`
 		DatabaseName   string `json:"database_name"`
@@ -76,7 +76,7 @@ func (api *Api) RestoreBackup(backup Backup, deploymentName, source, destination
 		return Deployment{}, err
 	}
 
-	body, err := api.restPost(api.apiUrl("/accounts/"+api.Config.AccountSlug+"/backups/"+backup.Id+"/restore"), data)
+	body, err := api.restPost(ctx, api.apiUrl("/accounts/"+api.AccountSlug+"/backups/"+backup.Id+"/restore"), data)
 	if err != nil {
 		return Deployment{}, err
 	}
@@ -0,0 +1,471 @@
+// Package mongohq is a client for the MongoHQ API and its Gopher websocket
+// streams.  It never writes to stdout or exits; every failure comes back as
+// an error, and API failures as an *APIError.
+package mongohq
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"github.com/gorilla/websocket"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultApiUrl = "https://api.mongohq.com"
+
+// Api holds everything needed to talk to MongoHQ on behalf of one user.
+// Account scoped calls use AccountSlug; see ForAccount to work with several
+// accounts at once.
+type Api struct {
+	// OauthToken may be replaced by a request that logs in again, so once
+	// the Api is shared between goroutines it is read with Token and
+	// changed with SetToken.
+	OauthToken  string
+	UserAgent   string
+	BaseUrl     string
+	ClientId    string
+	AccountSlug string
+	Retry       RetryPolicy
+	Trace       *Tracer
+
+	// Reauthenticate, when set, is called once when the API rejects
+	// OauthToken with a 401.  It returns a new token to retry the request
+	// with, or the error to fail it with.
+	Reauthenticate func(ctx context.Context, rejectedToken string) (string, error)
+
+	// Requests, when set, bounds the requests in flight at once across
+	// the Api and its copies.  Each request holds a slot while it is sent
+	// and its response read.
+	Requests chan struct{}
+}
+
+// tokenLock guards OauthToken in every Api.  It is one lock rather than
+// one per Api so that copies made by ForAccount stay safe to copy.
+var tokenLock sync.RWMutex
+
+// Token is the token requests are sent with.
+func (api *Api) Token() string {
+	tokenLock.RLock()
+	defer tokenLock.RUnlock()
+	return api.OauthToken
+}
+
+// SetToken replaces the token requests are sent with, such as after
+// logging in again.
+func (api *Api) SetToken(token string) {
+	tokenLock.Lock()
+	defer tokenLock.Unlock()
+	api.OauthToken = token
+}
+
+// ForAccount copies the Api for account scoped calls on another account.
+// The copy shares Requests, and may be used alongside the original.
+func (api *Api) ForAccount(slug string) *Api {
+	tokenLock.RLock()
+	defer tokenLock.RUnlock()
+	copied := *api
+	copied.AccountSlug = slug
+	return &copied
+}
+
+// RetryPolicy controls how sendRequest retries failed requests.  Only
+// idempotent verbs are retried unless RetryNonIdempotent is set; a 429 is
+// always safe to retry because the server did not act on the request.
+type RetryPolicy struct {
+	MaxAttempts        int
+	Backoff            time.Duration
+	MaxBackoff         time.Duration
+	RetryNonIdempotent bool
+}
+
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, Backoff: 500 * time.Millisecond, MaxBackoff: 30 * time.Second}
+
+type Hateos struct {
+	Rel  string `json:"rel"`
+	Href string `json:"href"`
+}
+
+type OkResponse struct {
+	Ok int
+}
+
+type ErrorResponse struct {
+	Error string
+}
+
+func (api *Api) baseUrl() string {
+	if api.BaseUrl == "" {
+		return DefaultApiUrl
+	}
+	return strings.TrimRight(api.BaseUrl, "/")
+}
+
+func (api *Api) apiUrl(path string) string {
+	return api.baseUrl() + path
+}
+
+// gopherSocketUrl swaps the scheme of the REST base url for its websocket
+// equivalent, so staging or a local stand-in serves both.
+func (api *Api) gopherSocketUrl(path string) string {
+	socketUrl := api.baseUrl()
+	if strings.HasPrefix(socketUrl, "http://") {
+		socketUrl = "ws://" + strings.TrimPrefix(socketUrl, "http://")
+	} else {
+		socketUrl = "wss://" + strings.TrimPrefix(socketUrl, "https://")
+	}
+	return socketUrl + "/mongo" + path + "?token=Bearer%20" + api.Token()
+}
+
+// usesPinnedChain is true when talking to the MongoHQ API, whose certificate
+// chain ships with the binary.  Other endpoints are verified against the
+// system roots instead.
+func (api *Api) usesPinnedChain() bool {
+	return api.baseUrl() == DefaultApiUrl
+}
+
+func ValidateApiUrl(apiUrl string) error {
+	parsedUrl, err := url.Parse(apiUrl)
+	if err != nil || parsedUrl.Host == "" || (parsedUrl.Scheme != "https" && parsedUrl.Scheme != "http") {
+		return errors.New("API url must be an absolute http or https url, such as " + DefaultApiUrl)
+	}
+	return nil
+}
+
+func decodePem(certInput string) tls.Certificate {
+	var cert tls.Certificate
+	certPEMBlock := []byte(certInput)
+	var certDERBlock *pem.Block
+	for {
+		certDERBlock, certPEMBlock = pem.Decode(certPEMBlock)
+		if certDERBlock == nil {
+			break
+		}
+		if certDERBlock != nil && certDERBlock.Type == "CERTIFICATE" {
+			cert.Certificate = append(cert.Certificate, certDERBlock.Bytes)
+		}
+	}
+	return cert
+}
+
+func (api *Api) sendRequest(request *http.Request) ([]byte, error) {
+	responseBody, err := api.sendRequestOnce(request)
+
+	var apiError *APIError
+	if api.Reauthenticate == nil || !errors.As(err, &apiError) || apiError.StatusCode != http.StatusUnauthorized {
+		return responseBody, err
+	}
+
+	token, reauthErr := api.Reauthenticate(request.Context(), api.Token())
+	if reauthErr != nil {
+		return responseBody, &APIError{Category: ErrorUnauthorized, StatusCode: http.StatusUnauthorized, Message: reauthErr.Error(), Method: request.Method, Path: request.URL.Path, Err: reauthErr}
+	}
+	api.SetToken(token)
+
+	retry := request.Clone(request.Context())
+	if request.GetBody != nil {
+		retry.Body, err = request.GetBody()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return api.sendRequestOnce(retry)
+}
+
+func (api *Api) sendRequestOnce(request *http.Request) ([]byte, error) {
+	client, err := api.buildHttpClient()
+
+	if err != nil {
+		return nil, errors.New("Error building HTTPS transport process.")
+	}
+
+	token := api.Token()
+	if token == "" {
+		return nil, &APIError{Category: ErrorUnauthorized, Message: "Unknown oauth token.  Please run `mongohq logout`, then rerun your command.", Method: request.Method, Path: request.URL.Path}
+	}
+
+	if api.Requests != nil {
+		select {
+		case api.Requests <- struct{}{}:
+			defer func() { <-api.Requests }()
+		case <-request.Context().Done():
+			return nil, newNetworkError(request, request.Context().Err())
+		}
+	}
+
+	request.Header.Set("Authorization", "Bearer "+token)
+	request.Header.Set("User-Agent", api.UserAgent)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept-Version", "2014-06")
+	response, err := api.doWithRetry(&client, request)
+
+	if err != nil {
+		return nil, newNetworkError(request, err)
+	}
+
+	responseBody, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	api.Trace.Body("<", responseBody)
+
+	if response.StatusCode >= 400 || string(responseBody) == "NOT FOUND" { // test for {error: "message"} type responses.
+		var errorResponse ErrorResponse
+		_ = json.Unmarshal(responseBody, &errorResponse)
+
+		status := response.StatusCode
+		if string(responseBody) == "NOT FOUND" {
+			status = http.StatusNotFound
+		}
+		return responseBody, newStatusError(request, status, response.Status, errorResponse.Error)
+	} else if response.Header.Get("X-User-Agent-Deprecated") == "true" {
+		return responseBody, errors.New(response.Header.Get("X-User-Agent-Deprecation-Message"))
+	}
+
+	return responseBody, nil
+}
+
+func (api *Api) doWithRetry(client *http.Client, request *http.Request) (*http.Response, error) {
+	policy := api.Retry
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if policy.Backoff <= 0 {
+		policy.Backoff = DefaultRetryPolicy.Backoff
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = DefaultRetryPolicy.MaxBackoff
+	}
+
+	for attempt := 1; ; attempt++ {
+		api.Trace.Request(request)
+		start := time.Now()
+		response, err := client.Do(request)
+		api.Trace.Response(request, response, err, time.Since(start))
+
+		if attempt >= policy.MaxAttempts || request.Context().Err() != nil || !policy.shouldRetry(request.Method, response, err) {
+			return response, err
+		}
+
+		delay := policy.delay(attempt, response)
+		if response != nil {
+			ioutil.ReadAll(response.Body)
+			response.Body.Close()
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-request.Context().Done():
+			return nil, request.Context().Err()
+		}
+
+		if request.GetBody != nil {
+			request.Body, err = request.GetBody()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (p RetryPolicy) shouldRetry(method string, response *http.Response, err error) bool {
+	if response != nil && response.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+
+	if !p.RetryNonIdempotent && !isIdempotent(method) {
+		return false
+	}
+
+	if err != nil {
+		return true
+	}
+
+	switch response.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// delay doubles the backoff for each attempt, with a little jitter so
+// parallel scripts do not retry in lockstep.  A Retry-After header from the
+// server wins, capped at MaxBackoff.
+func (p RetryPolicy) delay(attempt int, response *http.Response) time.Duration {
+	if response != nil {
+		if retryAfter, ok := parseRetryAfter(response.Header.Get("Retry-After")); ok {
+			if retryAfter > p.MaxBackoff {
+				return p.MaxBackoff
+			}
+			return retryAfter
+		}
+	}
+
+	backoff := p.Backoff << uint(attempt-1)
+	if backoff > p.MaxBackoff || backoff <= 0 {
+		backoff = p.MaxBackoff
+	}
+	return backoff + time.Duration(rand.Int63n(int64(backoff)/4+1))
+}
+
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		wait := date.Sub(time.Now())
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+func (api *Api) restGet(ctx context.Context, urlString string) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", urlString, nil)
+	if err != nil {
+		return nil, err
+	}
+	return api.sendRequest(request)
+}
+
+func (api *Api) restPost(ctx context.Context, urlString string, data []byte) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, "POST", urlString, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return api.sendRequest(request)
+}
+
+func (api *Api) restPatch(ctx context.Context, urlString string, data []byte) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, "PATCH", urlString, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return api.sendRequest(request)
+}
+
+func (api *Api) restDelete(ctx context.Context, urlString string) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, "DELETE", urlString, nil)
+	if err != nil {
+		return nil, err
+	}
+	return api.sendRequest(request)
+}
+
+func (api *Api) openWebsocket(ctx context.Context, message SocketMessage) (*websocket.Conn, error) {
+	dialer := websocket.Dialer{}
+	header := http.Header{}
+	header.Add("User-Agent", api.UserAgent)
+	socketUrl := api.gopherSocketUrl("/ws")
+	api.Trace.printf("> WEBSOCKET %s\n", redactUrl(socketUrl))
+	api.Trace.headers(">", header)
+	start := time.Now()
+	client, response, err := dialer.Dial(socketUrl, header)
+	if response != nil {
+		api.Trace.printf("< %s (%s)\n", response.Status, time.Since(start))
+	}
+	if err != nil {
+		api.Trace.printf("< websocket failed after %s: %s\n", time.Since(start), redactUrl(err.Error()))
+		return client, errors.New("could not initiate connection to websocket.")
+	}
+	jsonMessage, err := json.Marshal(message)
+	if err != nil {
+		return client, errors.New("Error marshalling websocket message.")
+	}
+	api.Trace.Frame(">", jsonMessage)
+	err = client.WriteMessage(websocket.TextMessage, jsonMessage)
+	if err != nil {
+		return client, errors.New("Error subscribing to websocket feed.")
+	}
+
+	// ReadMessage has no deadline of its own; closing the socket is what
+	// unblocks it when the command is cancelled or times out.
+	go func() {
+		<-ctx.Done()
+		client.Close()
+	}()
+	return client, nil
+}
+
+var kb = 1024.0
+var mb = kb * 1024.0
+var gb = mb * 1024.0
+var tb = gb * 1024.0
+
+func includeSignificantDigits(size float64) string {
+	if size < 10 {
+		return strconv.FormatFloat(size, 'f', 2, 64)
+	} else if size < 100 {
+		return strconv.FormatFloat(size, 'f', 1, 64)
+	} else {
+		return strconv.FormatFloat(size, 'f', 0, 64)
+	}
+}
+
+func PrettySize(size float64) string {
+	if size < kb {
+		return includeSignificantDigits(size) + "b"
+	} else if size < mb {
+		return includeSignificantDigits(size/kb) + "k"
+	} else if size < gb {
+		return includeSignificantDigits(size/mb) + "m"
+	} else if size < tb {
+		return includeSignificantDigits(size/gb) + "g"
+	} else {
+		return includeSignificantDigits(size/tb) + "t"
+	}
+}
+
+var hostRegex = regexp.MustCompile(".(?:mongohq|mongolayer).com")
+
+// FormatHostname strips the MongoHQ domain from a member hostname.
+func FormatHostname(host string) string {
+	return hostRegex.ReplaceAllLiteralString(host, "")
+}
+
+func (api *Api) buildHttpClient() (http.Client, error) {
+	if !api.usesPinnedChain() {
+		return http.Client{}, nil
+	}
+
+	certChain := decodePem(chain)
+	conf := tls.Config{}
+	conf.RootCAs = x509.NewCertPool()
+
+	for _, cert := range certChain.Certificate {
+		x509Cert, err := x509.ParseCertificate(cert)
+		if err != nil {
+			return http.Client{}, err
+		}
+		conf.RootCAs.AddCert(x509Cert)
+	}
+	conf.BuildNameToCertificate()
+
+	tr := http.Transport{TLSClientConfig: &conf}
+
+	return http.Client{Transport: &tr}, nil
+}
@@ -1,4 +1,4 @@
-package main
+package mongohq
 
 var chain = `-----BEGIN CERTIFICATE-----
 MIIFJDCCBAygAwIBAgIQBtizrQssataT7rNEmOVa9zANBgkqhkiG9w0BAQUFADBm
@@ -1,6 +1,7 @@
-package main
+package mongohq
 
 import (
+	"context"
 	"encoding/json"
 )
 
@@ -15,7 +16,7 @@ type Database struct {
 type DatabaseUser struct {
 	Username     string `json:"user"`
 	PasswordHash string `json:"pwd"`
-	ReadOnly     bool
+	ReadOnly     bool   `json:"readOnly"`
 }
 
 type DatabaseStats struct {
@@ -34,8 +35,8 @@ type DatabaseStats struct {
 	StorageSize       int            `json:"storageSize"`
 }
 
-func (api *Api) GetDatabases() ([]Database, error) {
-	body, err := api.restGet(api.apiUrl("/databases"))
+func (api *Api) GetDatabases(ctx context.Context) ([]Database, error) {
+	body, err := api.restGet(ctx, api.apiUrl("/databases"))
 
 	if err != nil {
 		return nil, err
@@ -45,8 +46,8 @@ func (api *Api) GetDatabases() ([]Database, error) {
 	return databasesSlice, err
 }
 
-func (api *Api) GetDatabase(deploymentName, databaseName string) (Database, error) {
-	body, err := api.restGet(api.apiUrl("/deployments/" + api.Config.AccountSlug + "/" + deploymentName + "/databases/" + databaseName))
+func (api *Api) GetDatabase(ctx context.Context, deploymentName, databaseName string) (Database, error) {
+	body, err := api.restGet(ctx, api.apiUrl("/deployments/"+api.AccountSlug+"/"+deploymentName+"/databases/"+databaseName))
 
 	if err != nil {
 		return Database{}, err
@@ -56,8 +57,8 @@ func (api *Api) GetDatabase(deploymentName, databaseName string) (Database, erro
 	return database, err
 }
 
-func (api *Api) GetDatabaseStats(database Database) (map[string]DatabaseStats, error) {
-	body, err := api.restGet(api.apiUrl("/deployments/" + api.Config.AccountSlug + "/" + database.DeploymentId + "/mongodb/" + database.Name + "/stats"))
+func (api *Api) GetDatabaseStats(ctx context.Context, database Database) (map[string]DatabaseStats, error) {
+	body, err := api.restGet(ctx, api.apiUrl("/deployments/"+api.AccountSlug+"/"+database.DeploymentId+"/mongodb/"+database.Name+"/stats"))
 
 	if err != nil {
 		return make(map[string]DatabaseStats), err
@@ -68,7 +69,7 @@ func (api *Api) GetDatabaseStats(database Database) (map[string]DatabaseStats, e
 	return dbStats, err
 }
 
-func (api *Api) CreateDatabase(deploymentName, databaseName string) (Database, error) {
+func (api *Api) CreateDatabase(ctx context.Context, deploymentName, databaseName string) (Database, error) {
 	type DatabaseCreate struct {
 		Name string `json:"name"`
 	}
@@ -79,7 +80,7 @@ func (api *Api) CreateDatabase(deploymentName, databaseName string) (Database, e
 		return Database{}, err
 	}
 
-	body, err := api.restPost(api.apiUrl("/deployments/"+api.Config.AccountSlug+"/"+deploymentName+"/databases"), data)
+	body, err := api.restPost(ctx, api.apiUrl("/deployments/"+api.AccountSlug+"/"+deploymentName+"/databases"), data)
 
 	if err != nil {
 		return Database{}, err
@@ -89,13 +90,13 @@ func (api *Api) CreateDatabase(deploymentName, databaseName string) (Database, e
 	return database, err
 }
 
-func (api *Api) RemoveDatabase(deploymentSlug, databaseName string) error {
-	_, err := api.restDelete(api.apiUrl("/deployments/" + api.Config.AccountSlug + "/" + deploymentSlug + "/databases/" + databaseName))
+func (api *Api) RemoveDatabase(ctx context.Context, deploymentSlug, databaseName string) error {
+	_, err := api.restDelete(ctx, api.apiUrl("/deployments/"+api.AccountSlug+"/"+deploymentSlug+"/databases/"+databaseName))
 	return err
 }
 
-func (api *Api) GetDatabaseUsers(deployment_id, database_name string) ([]DatabaseUser, error) {
-	body, err := api.restGet(api.apiUrl("/deployments/" + api.Config.AccountSlug + "/" + deployment_id + "/mongodb/" + database_name + "/users"))
+func (api *Api) GetDatabaseUsers(ctx context.Context, deployment_id, database_name string) ([]DatabaseUser, error) {
+	body, err := api.restGet(ctx, api.apiUrl("/deployments/"+api.AccountSlug+"/"+deployment_id+"/mongodb/"+database_name+"/users"))
 	if err != nil {
 		return make([]DatabaseUser, 0), err
 	}
@@ -104,7 +105,7 @@ func (api *Api) GetDatabaseUsers(deployment_id, database_name string) ([]Databas
 	return databaseUsersSlice, err
 }
 
-func (api *Api) CreateDatabaseUser(deploymentId, databaseName, username, password string) (OkResponse, error) {
+func (api *Api) CreateDatabaseUser(ctx context.Context, deploymentId, databaseName, username, password string) (OkResponse, error) {
 	type UserCreate struct {
 		Username string `json:"username"`
 		Password string `json:"password"`
@@ -117,7 +118,7 @@ func (api *Api) CreateDatabaseUser(deploymentId, databaseName, username, passwor
 		return OkResponse{}, err
 	}
 
-	body, err := api.restPost(api.apiUrl("/deployments/"+api.Config.AccountSlug+"/"+deploymentId+"/mongodb/"+databaseName+"/users"), data)
+	body, err := api.restPost(ctx, api.apiUrl("/deployments/"+api.AccountSlug+"/"+deploymentId+"/mongodb/"+databaseName+"/users"), data)
 
 	if err != nil {
 		return OkResponse{}, err
@@ -127,8 +128,8 @@ func (api *Api) CreateDatabaseUser(deploymentId, databaseName, username, passwor
 	return okResponse, err
 }
 
-func (api *Api) RemoveDatabaseUser(deploymentId, databaseName, username string) (OkResponse, error) {
-	body, err := api.restDelete(api.apiUrl("/deployments/" + api.Config.AccountSlug + "/" + deploymentId + "/mongodb/" + databaseName + "/users/" + username))
+func (api *Api) RemoveDatabaseUser(ctx context.Context, deploymentId, databaseName, username string) (OkResponse, error) {
+	body, err := api.restDelete(ctx, api.apiUrl("/deployments/"+api.AccountSlug+"/"+deploymentId+"/mongodb/"+databaseName+"/users/"+username))
 
 	if err != nil {
 		return OkResponse{}, err
@@ -1,21 +1,23 @@
-package main
+package mongohq
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"strings"
 )
 
 type Deployment struct {
-	Id                     string
-	Name                   string `json:"name"`
-	Plan                   string `json:"plan"`
-	Location               string `json:"location"`
-	CurrentPrimary         string `json:"current_primary"`
-	Status                 string `json:"status"`
-	Version                string
-	Members                []string
-	AllowMultipleDatabases bool `json:"allow_multiple_deployments"`
-	Databases              []Database
+	Id                     string     `json:"id"`
+	Name                   string     `json:"name"`
+	Plan                   string     `json:"plan"`
+	Location               string     `json:"location"`
+	CurrentPrimary         string     `json:"current_primary"`
+	Status                 string     `json:"status"`
+	Version                string     `json:"version"`
+	Members                []string   `json:"members"`
+	AllowMultipleDatabases bool       `json:"allow_multiple_deployments"`
+	Databases              []Database `json:"databases"`
 }
 
 func (d *Deployment) NameOrId() string {
@@ -78,27 +80,27 @@ type MongoStat struct {
 }
 
 func (m *MongoStat) PrettyNetIn() string {
-	return prettySize(float64(m.NetIn))
+	return PrettySize(float64(m.NetIn))
 }
 
 func (m *MongoStat) PrettyNetOut() string {
-	return prettySize(float64(m.NetOut))
+	return PrettySize(float64(m.NetOut))
 }
 
 func (m *MongoStat) PrettyMapped() string {
-	return prettySize(float64(m.Mapped * 1024 * 1024))
+	return PrettySize(float64(m.Mapped * 1024 * 1024))
 }
 
 func (m *MongoStat) PrettyVsize() string {
-	return prettySize(float64(m.Vsize * 1024 * 1024))
+	return PrettySize(float64(m.Vsize * 1024 * 1024))
 }
 
 func (m *MongoStat) PrettyRes() string {
-	return prettySize(float64(m.Res * 1024 * 1024))
+	return PrettySize(float64(m.Res * 1024 * 1024))
 }
 
-func (api *Api) GetDeployments() ([]Deployment, error) {
-	body, err := api.restGet(api.apiUrl("/accounts/" + api.Config.AccountSlug + "/deployments"))
+func (api *Api) GetDeployments(ctx context.Context) ([]Deployment, error) {
+	body, err := api.restGet(ctx, api.apiUrl("/accounts/"+api.AccountSlug+"/deployments"))
 
 	if err != nil {
 		return nil, err
@@ -108,8 +110,8 @@ func (api *Api) GetDeployments() ([]Deployment, error) {
 	return deploymentsSlice, err
 }
 
-func (api *Api) GetDeployment(deploymentId string) (Deployment, error) {
-	body, err := api.restGet(api.apiUrl("/deployments/"+api.Config.AccountSlug+"/"+deploymentId) + "?embed=databases,plan")
+func (api *Api) GetDeployment(ctx context.Context, deploymentId string) (Deployment, error) {
+	body, err := api.restGet(ctx, api.apiUrl("/deployments/"+api.AccountSlug+"/"+deploymentId)+"?embed=databases,plan")
 
 	if err != nil {
 		return Deployment{}, err
@@ -119,7 +121,7 @@ func (api *Api) GetDeployment(deploymentId string) (Deployment, error) {
 	return deployment, err
 }
 
-func (api *Api) CreateDeployment(deploymentName, databaseName, location string) (Deployment, error) {
+func (api *Api) CreateDeployment(ctx context.Context, deploymentName, databaseName, location string) (Deployment, error) {
 	type DeploymentCreate struct {
 		Name         string `json:"name"`
 		DatabaseName string `json:"database_name"`
@@ -133,7 +135,7 @@ func (api *Api) CreateDeployment(deploymentName, databaseName, location string)
 		return Deployment{}, err
 	}
 
-	body, err := api.restPost(api.apiUrl("/accounts/"+api.Config.AccountSlug+"/deployments/elastic"), data)
+	body, err := api.restPost(ctx, api.apiUrl("/accounts/"+api.AccountSlug+"/deployments/elastic"), data)
 
 	if err != nil {
 		return Deployment{}, err
@@ -143,12 +145,12 @@ func (api *Api) CreateDeployment(deploymentName, databaseName, location string)
 	return deployment, err
 }
 
-func (api *Api) RemoveDeployment(deploymentSlug string) error {
-	_, err := api.restDelete(api.apiUrl("/deployments/" + api.Config.AccountSlug + "/" + deploymentSlug))
+func (api *Api) RemoveDeployment(ctx context.Context, deploymentSlug string) error {
+	_, err := api.restDelete(ctx, api.apiUrl("/deployments/"+api.AccountSlug+"/"+deploymentSlug))
 	return err
 }
 
-func (api *Api) RenameDeployment(deploymentId, name string) (Deployment, error) {
+func (api *Api) RenameDeployment(ctx context.Context, deploymentId, name string) (Deployment, error) {
 	type DeploymentRenameParams struct {
 		Name string `json:"name"`
 	}
@@ -158,7 +160,7 @@ func (api *Api) RenameDeployment(deploymentId, name string) (Deployment, error)
 		return Deployment{}, err
 	}
 
-	body, err := api.restPatch(api.apiUrl("/deployments/"+api.Config.AccountSlug+"/"+deploymentId), data)
+	body, err := api.restPatch(ctx, api.apiUrl("/deployments/"+api.AccountSlug+"/"+deploymentId), data)
 	if err != nil {
 		return Deployment{}, err
 	}
@@ -167,9 +169,9 @@ func (api *Api) RenameDeployment(deploymentId, name string) (Deployment, error)
 	return deployment, err
 }
 
-func (api *Api) BackupDeployment(deploymentId string) (Backup, error) {
+func (api *Api) BackupDeployment(ctx context.Context, deploymentId string) (Backup, error) {
 	var err error
-	body, err := api.restPost(api.apiUrl("/deployments/"+api.Config.AccountSlug+"/"+deploymentId+"/backups"), []byte{})
+	body, err := api.restPost(ctx, api.apiUrl("/deployments/"+api.AccountSlug+"/"+deploymentId+"/backups"), []byte{})
 	if err != nil {
 		return Backup{}, err
 	}
@@ -178,17 +180,19 @@ func (api *Api) BackupDeployment(deploymentId string) (Backup, error) {
 	return backup, err
 }
 
-func (api *Api) DeploymentMongostat(deploymentSlug string, outputFormatter func(map[string]MongoStat, error)) error {
-	message := SocketMessage{Command: "subscribe", Uuid: "12345", Message: Message{Account: api.Config.AccountSlug, Deployment: deploymentSlug, Type: "mongo.stats"}}
-	socket, err := api.openWebsocket(message)
+func (api *Api) DeploymentMongostat(ctx context.Context, deploymentSlug string, outputFormatter func(map[string]MongoStat, error)) error {
+	message := SocketMessage{Command: "subscribe", Uuid: "12345", Message: Message{Account: api.AccountSlug, Deployment: deploymentSlug, Type: "mongo.stats"}}
+	socket, err := api.openWebsocket(ctx, message)
 	if err != nil {
 		return err
 	}
+	defer socket.Close()
 
 	for {
 		_, msg, err := socket.ReadMessage()
+		api.Trace.Frame("<", msg)
 		if err != nil {
-			outputFormatter(make(map[string]MongoStat, 0), err)
+			return socketReadError(ctx, err)
 		}
 
 		// catch the first success response
@@ -208,15 +212,29 @@ func (api *Api) DeploymentMongostat(deploymentSlug string, outputFormatter func(
 	}
 }
 
-func (api *Api) DeploymentOplog(deploymentSlug string, outputFormatter func(string, error)) error {
+func (api *Api) DeploymentOplog(ctx context.Context, deploymentSlug string, outputFormatter func(string, error)) error {
 	message := SocketMessage{Command: "subscribe", Uuid: "12345", Message: Message{Deployment: deploymentSlug, Type: "mongo.oplog"}}
-	socket, err := api.openWebsocket(message)
+	socket, err := api.openWebsocket(ctx, message)
 	if err != nil {
 		return err
 	}
+	defer socket.Close()
 
 	for {
 		_, msg, err := socket.ReadMessage()
+		api.Trace.Frame("<", msg)
+		if err != nil {
+			return socketReadError(ctx, err)
+		}
 		outputFormatter(string(msg), err)
 	}
 }
+
+// socketReadError reports a cancelled command as such, rather than as the
+// closed connection it caused.
+func socketReadError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return errors.New("Websocket connection closed: " + err.Error())
+}
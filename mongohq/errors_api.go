@@ -0,0 +1,96 @@
+package mongohq
+
+import (
+	"context"
+	"net/http"
+)
+
+// ErrorCategory groups API failures by what the caller can do about them.
+type ErrorCategory int
+
+const (
+	ErrorNotFound ErrorCategory = iota + 1
+	ErrorUnauthorized
+	ErrorValidation
+	ErrorServer
+	ErrorNetwork
+)
+
+func (c ErrorCategory) String() string {
+	switch c {
+	case ErrorNotFound:
+		return "not found"
+	case ErrorUnauthorized:
+		return "unauthorized"
+	case ErrorValidation:
+		return "validation"
+	case ErrorServer:
+		return "server"
+	case ErrorNetwork:
+		return "network"
+	}
+	return "unknown"
+}
+
+// APIError is returned by sendRequest for every failed request.  Use
+// errors.As to inspect it; Error() is the message shown to users.
+type APIError struct {
+	Category   ErrorCategory
+	StatusCode int    // zero when the request never got a response
+	Message    string // server supplied error, or a default for the category
+	Method     string
+	Path       string
+	Err        error // underlying transport error for ErrorNetwork
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+func errorCategoryForStatus(status int) ErrorCategory {
+	switch {
+	case status == http.StatusNotFound:
+		return ErrorNotFound
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ErrorUnauthorized
+	case status == http.StatusTooManyRequests || status >= 500:
+		return ErrorServer
+	}
+	return ErrorValidation
+}
+
+func defaultErrorMessage(category ErrorCategory, status string) string {
+	switch category {
+	case ErrorNotFound:
+		return "Object not found"
+	case ErrorUnauthorized:
+		return "Could not access the requested object.  Double check the arguments, or run `mongohq logout` and re-run the prior command."
+	case ErrorServer:
+		return "MongoHQ service returned an error. Check your parameters and try again, or check our status page: https://status.mongohq.com."
+	case ErrorNetwork:
+		return "We couldn't reach the MongoHQ API.  Typically, this means your internet connection has gone AWOL."
+	}
+	return "Response status " + status
+}
+
+func newStatusError(request *http.Request, status int, statusText string, serverMessage string) *APIError {
+	category := errorCategoryForStatus(status)
+	if serverMessage == "" {
+		serverMessage = defaultErrorMessage(category, statusText)
+	}
+	return &APIError{Category: category, StatusCode: status, Message: serverMessage, Method: request.Method, Path: request.URL.Path}
+}
+
+func newNetworkError(request *http.Request, err error) *APIError {
+	switch request.Context().Err() {
+	case context.Canceled:
+		return &APIError{Category: ErrorNetwork, Message: "Request cancelled.", Method: request.Method, Path: request.URL.Path, Err: context.Canceled}
+	case context.DeadlineExceeded:
+		return &APIError{Category: ErrorNetwork, Message: "Timed out waiting for the MongoHQ API.", Method: request.Method, Path: request.URL.Path, Err: context.DeadlineExceeded}
+	}
+	return &APIError{Category: ErrorNetwork, Message: defaultErrorMessage(ErrorNetwork, "") + " (" + err.Error() + ")", Method: request.Method, Path: request.URL.Path, Err: err}
+}
@@ -1,11 +1,12 @@
-package main
+package mongohq
 
 import (
+	"context"
 	"encoding/json"
 )
 
-func (api *Api) GetLocations() ([]string, error) {
-	body, err := api.restGet(api.apiUrl("/locations"))
+func (api *Api) GetLocations(ctx context.Context) ([]string, error) {
+	body, err := api.restGet(ctx, api.apiUrl("/locations"))
 
 	if err != nil {
 		return make([]string, 0), err
@@ -1,13 +1,17 @@
-package main
+package mongohq
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/url"
 	"sort"
 	"strconv"
 	"time"
 )
 
+var errUnexpectedLogs = errors.New("Error reading historical logs: unexpected response from MongoHQ.")
+
 type HistoricalLog struct {
 	Host      string
 	Message   string
@@ -31,21 +35,21 @@ func (hl HistoricalLogs) Less(i, j int) bool {
 	return hl[i].Timestamp.Before(hl[j].Timestamp)
 }
 
-func (api *Api) GetHistoricalLogs(deploymentSlug, search, exclude, regexp string, limit int, fromDate *time.Time, toDate *time.Time) (HistoricalLogs, int, error) {
+func (api *Api) GetHistoricalLogs(ctx context.Context, deploymentSlug, search, exclude, regexp string, limit int, fromDate *time.Time, toDate *time.Time) (HistoricalLogs, int, error) {
 	var historicalLogs HistoricalLogs
 	maxHostnameLength := 0
 
-	urlPath := "/deployments/" + api.Config.AccountSlug + "/" + deploymentSlug + "/historical_logs?size=" + strconv.Itoa(limit) + "&sort=desc"
+	urlPath := "/deployments/" + api.AccountSlug + "/" + deploymentSlug + "/historical_logs?size=" + strconv.Itoa(limit) + "&sort=desc"
 
-	if regexp != "<string>" {
+	if regexp != "" {
 		urlPath = urlPath + "&grep=" + url.QueryEscape(regexp)
 	}
 
-	if search != "<string>" {
+	if search != "" {
 		urlPath = urlPath + "&search=" + url.QueryEscape(search)
 	}
 
-	if exclude != "<string>" {
+	if exclude != "" {
 		urlPath = urlPath + "&exclude=" + url.QueryEscape(exclude)
 	}
 
@@ -57,7 +61,7 @@ func (api *Api) GetHistoricalLogs(deploymentSlug, search, exclude, regexp string
 		urlPath = urlPath + "&to_date=" + toDate.Format(time.RFC3339Nano) + "&from_date=2010-01-01T00:00:00Z"
 	}
 
-	body, err := api.restGet(api.apiUrl(urlPath))
+	body, err := api.restGet(ctx, api.apiUrl(urlPath))
 	if err != nil {
 		return nil, maxHostnameLength, err
 	}
@@ -69,13 +73,26 @@ func (api *Api) GetHistoricalLogs(deploymentSlug, search, exclude, regexp string
 	}
 
 	for host, logs := range result {
-		for _, log := range logs.(map[string]interface{})["logs"].([]interface{}) {
-			ts := log.(map[string]interface{})["ts"].(string)
+		hostLogs, ok := logs.(map[string]interface{})
+		if !ok {
+			return nil, maxHostnameLength, errUnexpectedLogs
+		}
+		entries, ok := hostLogs["logs"].([]interface{})
+		if !ok {
+			return nil, maxHostnameLength, errUnexpectedLogs
+		}
+		for _, entry := range entries {
+			log, ok := entry.(map[string]interface{})
+			if !ok {
+				return nil, maxHostnameLength, errUnexpectedLogs
+			}
+			ts, _ := log["ts"].(string)
+			message, _ := log["message"].(string)
 			timestamp, _ := time.Parse("2006-01-02T15:04:05Z", ts)
-			if maxHostnameLength < len(formatHostname(host)) {
-				maxHostnameLength = len(formatHostname(host))
+			if maxHostnameLength < len(FormatHostname(host)) {
+				maxHostnameLength = len(FormatHostname(host))
 			}
-			historicalLogs = append(historicalLogs, HistoricalLog{Host: host, Message: log.(map[string]interface{})["message"].(string), Timestamp: timestamp})
+			historicalLogs = append(historicalLogs, HistoricalLog{Host: host, Message: message, Timestamp: timestamp})
 		}
 	}
 	sort.Sort(historicalLogs)
@@ -0,0 +1,727 @@
+// Package mongohqtest provides an in-process fake of the MongoHQ REST API
+// and the Gopher websocket, for exercising the mongohq package and the CLI
+// without network access.
+//
+//	server := mongohqtest.NewServer()
+//	defer server.Close()
+//	api := server.Api()
+//	deployments, err := api.GetDeployments(ctx)
+//
+// The fixtures are plain exported fields; change them before (or between)
+// requests to shape what the server returns.
+package mongohqtest
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/MongoHQ/mongohq-cli/mongohq"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Server struct {
+	*httptest.Server
+
+	// Credentials accepted by /oauth/token.  When Otp is set, an attempt
+	// without it in the X-Mongohq-Otp header is answered with
+	// "required; <OtpMethod>", such as "required; app, backup".  Each of
+	// BackupCodes is accepted in place of Otp once.
+	Username    string
+	Password    string
+	Otp         string
+	OtpMethod   string
+	BackupCodes []string
+	Token       string
+
+	// Browser and device logins are approved straight away, except that a
+	// device code is reported pending for its first DevicePendingPolls
+	// polls.
+	DevicePendingPolls int
+
+	User      mongohq.User
+	Accounts  []mongohq.Account
+	Locations []string
+
+	// Keyed by account slug.
+	Deployments map[string][]mongohq.Deployment
+	Backups     map[string][]mongohq.Backup
+
+	// SummaryListings makes the deployments list carry only each
+	// deployment's id and name, as some API versions do, leaving the
+	// details to the deployment's own endpoint.
+	SummaryListings bool
+
+	// Keyed by "<deployment>/<database>".
+	DatabaseUsers map[string][]mongohq.DatabaseUser
+	DatabaseStats map[string]map[string]mongohq.DatabaseStats
+
+	// Keyed by deployment name; each log is keyed by host.
+	Logs map[string]map[string][]Log
+
+	// Frames sent, in order, to websocket subscribers of mongo.stats and
+	// mongo.oplog.
+	Stats []map[string]mongohq.MongoStat
+	Oplog []string
+
+	// Authorizations listed by /authorizations.  The one with Id
+	// LoginAuthorization stands for Token; the others are created with
+	// POST /authorizations, and their tokens are accepted too.
+	Authorizations []mongohq.Authorization
+
+	// Now stamps the backups and tokens the server creates.  It starts as
+	// a fixed time, so output that shows them is the same on every run.
+	Now func() time.Time
+
+	// Fail answers the requests it names, as "METHOD /path", with that
+	// status instead of serving them, such as
+	// {"GET /accounts/test-account": 503}.
+	Fail map[string]int
+
+	// Requests records "METHOD /path" for every request received.
+	Requests []string
+
+	issued       map[string]string
+	created      int
+	codes        map[string]authorizationCode
+	devicePolls  map[string]int
+	loginRevoked bool
+	mu           sync.Mutex
+}
+
+const LoginAuthorization = "auth1"
+
+type authorizationCode struct {
+	challenge   string
+	redirectUri string
+}
+
+type Log struct {
+	Ts      string `json:"ts"`
+	Message string `json:"message"`
+}
+
+// NewServer starts a server seeded with one account holding one running
+// deployment, a database, a user and a completed backup.
+func NewServer() *Server {
+	s := &Server{
+		Username:  "user@example.com",
+		Password:  "password",
+		OtpMethod: "sms",
+		Token:     "test-token",
+		User:      mongohq.User{Id: "u1", Email: "user@example.com", Name: "Test User"},
+		Accounts: []mongohq.Account{
+			{Id: "a1", Name: "Test Account", Slug: "test-account", Active: true, OwnerName: "Test User", OwnerEmail: "user@example.com",
+				Users: []mongohq.User{{Id: "u1", Email: "user@example.com", Name: "Test User"}}},
+		},
+		Locations: []string{"aws:us-east-1", "rackspace:dfw"},
+		Deployments: map[string][]mongohq.Deployment{
+			"test-account": {
+				{Id: "d1", Name: "test-deployment", Plan: "elastic", Location: "aws:us-east-1", CurrentPrimary: "c0.test.mongohq.com:10000",
+					Status: "running", Version: "2.6.3", Members: []string{"c0.test.mongohq.com:10000", "c1.test.mongohq.com:10001"},
+					Databases: []mongohq.Database{{Id: "db1", Name: "test-database", Status: "running", Plan: "elastic", DeploymentId: "test-deployment"}}},
+			},
+		},
+		Backups: map[string][]mongohq.Backup{
+			"test-account": {
+				{Id: "b1", CreatedAt: "2014-07-01T12:00:00Z", DatabaseNames: []string{"test-database"}, Status: "complete", DeploymentSlug: "test-deployment",
+					Type: "on-demand", Filename: "test-deployment_2014-07-01.tgz", Size: 1048576,
+					Links: []mongohq.Hateos{{Rel: "download", Href: "https://backups.example.com/b1.tgz"}}},
+			},
+		},
+		DatabaseUsers: map[string][]mongohq.DatabaseUser{
+			"test-deployment/test-database": {{Username: "app"}},
+		},
+		DatabaseStats: map[string]map[string]mongohq.DatabaseStats{
+			"test-deployment/test-database": {
+				"c0.test.mongohq.com:10000": {Database: "test-database", Collections: 3, DataSize: 2048, FileSize: 67108864, IndexSize: 8192, Objects: 12, Ok: 1},
+			},
+		},
+		Logs: map[string]map[string][]Log{
+			"test-deployment": {
+				"c0.test.mongohq.com:10000": {{Ts: "2014-07-01T12:00:00Z", Message: "connection accepted"}, {Ts: "2014-07-01T12:00:01Z", Message: "end connection"}},
+			},
+		},
+		Stats: []map[string]mongohq.MongoStat{
+			{"c0.test.mongohq.com:10000": {Inserts: "1", Query: "2", Update: "0", Delete: "0", Getmore: "0", Command: "4", Locked: "0.1%", Conn: 5, Repl: "PRI"}},
+		},
+		Oplog: []string{`{"op":"i","ns":"test-database.things"}`},
+		Authorizations: []mongohq.Authorization{
+			{Id: LoginAuthorization, Client: "MongoHQ CLI", CreatedAt: "2014-07-01T12:00:00Z", LastUsedAt: "2014-07-02T08:30:00Z"},
+		},
+		issued:             map[string]string{},
+		codes:              map[string]authorizationCode{},
+		devicePolls:        map[string]int{},
+		DevicePendingPolls: 1,
+		Now:                func() time.Time { return time.Date(2014, 7, 3, 9, 0, 0, 0, time.UTC) },
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Api returns a client pointed at the server, authenticated and scoped to
+// the first account.
+func (s *Server) Api() *mongohq.Api {
+	api := &mongohq.Api{OauthToken: s.Token, UserAgent: "mongohqtest", BaseUrl: s.URL, Retry: mongohq.RetryPolicy{MaxAttempts: 1}}
+	if len(s.Accounts) > 0 {
+		api.AccountSlug = s.Accounts[0].Slug
+	}
+	return api
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Requests = append(s.Requests, r.Method+" "+r.URL.Path)
+	if status := s.Fail[r.Method+" "+r.URL.Path]; status != 0 {
+		writeError(w, status, http.StatusText(status))
+		return
+	}
+
+	switch r.URL.Path {
+	case "/oauth/token":
+		s.token(w, r)
+		return
+	case "/oauth/authorize":
+		s.authorize(w, r)
+		return
+	case "/oauth/device/code":
+		s.deviceCode(w, r)
+		return
+	}
+
+	if r.URL.Path == "/mongo/ws" {
+		if r.URL.Query().Get("token") != "Bearer "+s.Token {
+			writeError(w, http.StatusUnauthorized, "Invalid token")
+			return
+		}
+		// the socket outlives this request; let other requests through
+		s.mu.Unlock()
+		s.socket(w, r)
+		s.mu.Lock()
+		return
+	}
+
+	authorizationId := s.authorizationFor(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	if authorizationId == "" {
+		writeError(w, http.StatusUnauthorized, "Invalid token")
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	route := r.Method + " " + parts[0]
+
+	switch {
+	case route == "DELETE authorization" && len(parts) == 1:
+		s.revoke(authorizationId)
+		writeJSON(w, mongohq.OkResponse{Ok: 1})
+	case parts[0] == "authorizations":
+		s.authorizations(w, r, authorizationId, parts[1:])
+	case route == "GET user" && len(parts) == 1:
+		writeJSON(w, s.User)
+	case route == "GET locations" && len(parts) == 1:
+		writeJSON(w, s.Locations)
+	case parts[0] == "accounts":
+		s.accounts(w, r, parts[1:])
+	case parts[0] == "deployments" && len(parts) >= 3:
+		s.deployments(w, r, parts[1], parts[2], parts[3:])
+	default:
+		writeNotFound(w)
+	}
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	var arguments struct {
+		mongohq.AuthenticationArguments
+		Code         string `json:"code"`
+		RedirectUri  string `json:"redirect_uri"`
+		CodeVerifier string `json:"code_verifier"`
+		DeviceCode   string `json:"device_code"`
+	}
+	json.NewDecoder(r.Body).Decode(&arguments)
+
+	switch arguments.GrantType {
+	case "authorization_code":
+		code, ok := s.codes[arguments.Code]
+		delete(s.codes, arguments.Code)
+		if !ok || code.redirectUri != arguments.RedirectUri || code.challenge != codeChallenge(arguments.CodeVerifier) {
+			writeOauthError(w, "invalid_grant")
+			return
+		}
+		s.grantToken(w)
+		return
+	case "urn:ietf:params:oauth:grant-type:device_code":
+		polls, ok := s.devicePolls[arguments.DeviceCode]
+		if !ok {
+			writeOauthError(w, "invalid_grant")
+			return
+		}
+		s.devicePolls[arguments.DeviceCode] = polls + 1
+		if polls < s.DevicePendingPolls {
+			writeOauthError(w, "authorization_pending")
+			return
+		}
+		delete(s.devicePolls, arguments.DeviceCode)
+		s.grantToken(w)
+		return
+	}
+
+	if arguments.Username != s.Username || arguments.Password != s.Password {
+		writeError(w, http.StatusUnauthorized, "Invalid username or password")
+		return
+	}
+
+	if s.Otp != "" && r.Header.Get("X-Mongohq-Otp") != s.Otp && !s.useBackupCode(r.Header.Get("X-Mongohq-Otp")) {
+		w.Header().Set("X-Mongohq-Otp", "required; "+s.OtpMethod)
+		writeError(w, http.StatusUnauthorized, "Two factor authentication required")
+		return
+	}
+
+	s.grantToken(w)
+}
+
+func (s *Server) useBackupCode(code string) bool {
+	for i, backupCode := range s.BackupCodes {
+		if code != "" && code == backupCode {
+			s.BackupCodes = append(s.BackupCodes[:i:i], s.BackupCodes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) grantToken(w http.ResponseWriter) {
+	s.loginRevoked = false
+	writeJSON(w, map[string]string{"access_token": s.Token, "token_type": "bearer"})
+}
+
+// authorize stands in for the browser login page: it approves at once and
+// redirects back with a code, so following the redirect completes a login.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("response_type") != "code" || query.Get("code_challenge_method") != "S256" || query.Get("redirect_uri") == "" {
+		writeOauthError(w, "invalid_request")
+		return
+	}
+
+	s.created++
+	code := "code" + strconv.Itoa(s.created)
+	s.codes[code] = authorizationCode{challenge: query.Get("code_challenge"), redirectUri: query.Get("redirect_uri")}
+
+	redirect := query.Get("redirect_uri") + "?code=" + code + "&state=" + url.QueryEscape(query.Get("state"))
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+func (s *Server) deviceCode(w http.ResponseWriter, r *http.Request) {
+	s.created++
+	deviceCode := "device" + strconv.Itoa(s.created)
+	s.devicePolls[deviceCode] = 0
+
+	writeJSON(w, mongohq.DeviceCode{DeviceCode: deviceCode, UserCode: "WDJB-MJHT", VerificationUri: s.URL + "/device",
+		VerificationUriComplete: s.URL + "/device?user_code=WDJB-MJHT", ExpiresIn: 600, Interval: 1})
+}
+
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// authorizationFor returns the id of the authorization a token belongs to,
+// or "" when the token is not valid.
+func (s *Server) authorizationFor(token string) string {
+	if token == s.Token && !s.loginRevoked {
+		return LoginAuthorization
+	}
+	return s.issued[token]
+}
+
+func (s *Server) authorizations(w http.ResponseWriter, r *http.Request, currentId string, parts []string) {
+	switch {
+	case r.Method == "GET" && len(parts) == 0:
+		authorizations := []mongohq.Authorization{}
+		for _, authorization := range s.Authorizations {
+			authorization.Current = authorization.Id == currentId
+			authorization.Token = ""
+			authorizations = append(authorizations, authorization)
+		}
+		writeJSON(w, authorizations)
+	case r.Method == "POST" && len(parts) == 0:
+		var arguments struct {
+			Description string `json:"description"`
+		}
+		json.NewDecoder(r.Body).Decode(&arguments)
+
+		s.created++
+		id := "auth" + strconv.Itoa(s.created+1)
+		token := "token-" + id
+		authorization := mongohq.Authorization{Id: id, Client: "MongoHQ CLI", Description: arguments.Description, CreatedAt: s.Now().UTC().Format(time.RFC3339)}
+		s.Authorizations = append(s.Authorizations, authorization)
+		s.issued[token] = id
+
+		authorization.Token = token
+		writeJSON(w, authorization)
+	case r.Method == "DELETE" && len(parts) == 1:
+		if !s.revoke(parts[0]) {
+			writeNotFound(w)
+			return
+		}
+		writeJSON(w, mongohq.OkResponse{Ok: 1})
+	default:
+		writeNotFound(w)
+	}
+}
+
+func (s *Server) revoke(id string) bool {
+	for i, authorization := range s.Authorizations {
+		if authorization.Id != id {
+			continue
+		}
+		s.Authorizations = append(s.Authorizations[:i], s.Authorizations[i+1:]...)
+		for token, issuedId := range s.issued {
+			if issuedId == id {
+				delete(s.issued, token)
+			}
+		}
+		if id == LoginAuthorization {
+			s.loginRevoked = true
+		}
+		return true
+	}
+	return false
+}
+
+func (s *Server) accounts(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) == 0 {
+		writeJSON(w, s.Accounts)
+		return
+	}
+
+	account := s.account(parts[0])
+	if account == nil {
+		writeNotFound(w)
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == "GET":
+		writeJSON(w, account)
+	case len(parts) == 2 && parts[1] == "deployments" && r.Method == "GET":
+		if !s.SummaryListings {
+			writeJSON(w, s.Deployments[account.Slug])
+			return
+		}
+		summaries := []mongohq.Deployment{}
+		for _, deployment := range s.Deployments[account.Slug] {
+			summaries = append(summaries, mongohq.Deployment{Id: deployment.Id, Name: deployment.Name})
+		}
+		writeJSON(w, summaries)
+	case len(parts) == 3 && parts[1] == "deployments" && parts[2] == "elastic" && r.Method == "POST":
+		s.createDeployment(w, r, account.Slug)
+	case len(parts) == 2 && parts[1] == "backups" && r.Method == "GET":
+		writeJSON(w, s.Backups[account.Slug])
+	case len(parts) >= 3 && parts[1] == "backups":
+		s.backup(w, r, account.Slug, parts[2], parts[3:])
+	default:
+		writeNotFound(w)
+	}
+}
+
+func (s *Server) createDeployment(w http.ResponseWriter, r *http.Request, accountSlug string) {
+	var params struct {
+		Name         string `json:"name"`
+		DatabaseName string `json:"database_name"`
+		Location     string `json:"location"`
+	}
+	json.NewDecoder(r.Body).Decode(&params)
+
+	if params.Name == "" || params.DatabaseName == "" || params.Location == "" {
+		writeError(w, http.StatusUnprocessableEntity, "name, database_name and location are required")
+		return
+	}
+
+	writeJSON(w, s.addDeployment(accountSlug, params.Name, params.DatabaseName, params.Location))
+}
+
+// addDeployment creates deployments as already running, so pollers finish
+// on their first status check.
+func (s *Server) addDeployment(accountSlug, name, databaseName, location string) mongohq.Deployment {
+	deployment := mongohq.Deployment{Id: name, Name: name, Plan: "elastic", Location: location, Status: "running", Version: "2.6.3",
+		CurrentPrimary: "c0." + name + ".mongohq.com:10000", Members: []string{"c0." + name + ".mongohq.com:10000"},
+		Databases: []mongohq.Database{{Id: databaseName, Name: databaseName, Status: "running", Plan: "elastic", DeploymentId: name}}}
+	s.Deployments[accountSlug] = append(s.Deployments[accountSlug], deployment)
+	return deployment
+}
+
+func (s *Server) backup(w http.ResponseWriter, r *http.Request, accountSlug, backupId string, parts []string) {
+	var backup *mongohq.Backup
+	for i := range s.Backups[accountSlug] {
+		if s.Backups[accountSlug][i].Id == backupId || s.Backups[accountSlug][i].Filename == backupId {
+			backup = &s.Backups[accountSlug][i]
+		}
+	}
+	if backup == nil {
+		writeNotFound(w)
+		return
+	}
+
+	switch {
+	case len(parts) == 0 && r.Method == "GET":
+		writeJSON(w, backup)
+	case len(parts) == 1 && parts[0] == "restore" && r.Method == "POST":
+		var params struct {
+			Name         string `json:"name"`
+			DatabaseName string `json:"database_name"`
+		}
+		json.NewDecoder(r.Body).Decode(&params)
+		writeJSON(w, s.addDeployment(accountSlug, params.Name, params.DatabaseName, "aws:us-east-1"))
+	default:
+		writeNotFound(w)
+	}
+}
+
+func (s *Server) deployments(w http.ResponseWriter, r *http.Request, accountSlug, deploymentName string, parts []string) {
+	index := -1
+	for i, deployment := range s.Deployments[accountSlug] {
+		if deployment.Name == deploymentName || deployment.Id == deploymentName {
+			index = i
+		}
+	}
+	if index < 0 {
+		writeNotFound(w)
+		return
+	}
+	deployment := &s.Deployments[accountSlug][index]
+
+	if len(parts) == 0 {
+		switch r.Method {
+		case "GET":
+			writeJSON(w, deployment)
+		case "PATCH":
+			var params struct {
+				Name string `json:"name"`
+			}
+			json.NewDecoder(r.Body).Decode(&params)
+			deployment.Name = params.Name
+			writeJSON(w, deployment)
+		case "DELETE":
+			s.Deployments[accountSlug] = append(s.Deployments[accountSlug][:index], s.Deployments[accountSlug][index+1:]...)
+			writeJSON(w, mongohq.OkResponse{Ok: 1})
+		default:
+			writeNotFound(w)
+		}
+		return
+	}
+
+	switch {
+	case parts[0] == "backups" && len(parts) == 1:
+		s.deploymentBackups(w, r, accountSlug, deployment)
+	case parts[0] == "databases":
+		s.databases(w, r, deployment, parts[1:])
+	case parts[0] == "mongodb" && len(parts) >= 3:
+		s.mongodb(w, r, deployment, parts[1], parts[2:])
+	case parts[0] == "historical_logs" && len(parts) == 1:
+		s.historicalLogs(w, r, deployment)
+	default:
+		writeNotFound(w)
+	}
+}
+
+func (s *Server) deploymentBackups(w http.ResponseWriter, r *http.Request, accountSlug string, deployment *mongohq.Deployment) {
+	if r.Method == "POST" {
+		databaseNames := []string{}
+		for _, database := range deployment.Databases {
+			databaseNames = append(databaseNames, database.Name)
+		}
+		id := "b" + strconv.Itoa(len(s.Backups[accountSlug])+1)
+		backup := mongohq.Backup{Id: id, CreatedAt: s.Now().UTC().Format(time.RFC3339), DatabaseNames: databaseNames, Status: "complete",
+			DeploymentSlug: deployment.Name, Type: "on-demand", Filename: deployment.Name + "_" + id + ".tgz", Size: 1024,
+			Links: []mongohq.Hateos{{Rel: "download", Href: "https://backups.example.com/" + id + ".tgz"}}}
+		s.Backups[accountSlug] = append(s.Backups[accountSlug], backup)
+		writeJSON(w, backup)
+		return
+	}
+
+	backups := []mongohq.Backup{}
+	for _, backup := range s.Backups[accountSlug] {
+		if backup.DeploymentSlug == deployment.Name {
+			backups = append(backups, backup)
+		}
+	}
+	writeJSON(w, backups)
+}
+
+func (s *Server) databases(w http.ResponseWriter, r *http.Request, deployment *mongohq.Deployment, parts []string) {
+	if len(parts) == 0 {
+		switch r.Method {
+		case "GET":
+			writeJSON(w, deployment.Databases)
+		case "POST":
+			var params struct {
+				Name string `json:"name"`
+			}
+			json.NewDecoder(r.Body).Decode(&params)
+			database := mongohq.Database{Id: params.Name, Name: params.Name, Status: "running", Plan: deployment.Plan, DeploymentId: deployment.Name}
+			deployment.Databases = append(deployment.Databases, database)
+			writeJSON(w, database)
+		default:
+			writeNotFound(w)
+		}
+		return
+	}
+
+	for i, database := range deployment.Databases {
+		if database.Name != parts[0] {
+			continue
+		}
+		switch r.Method {
+		case "GET":
+			writeJSON(w, database)
+		case "DELETE":
+			deployment.Databases = append(deployment.Databases[:i], deployment.Databases[i+1:]...)
+			writeJSON(w, mongohq.OkResponse{Ok: 1})
+		default:
+			writeNotFound(w)
+		}
+		return
+	}
+	writeNotFound(w)
+}
+
+func (s *Server) mongodb(w http.ResponseWriter, r *http.Request, deployment *mongohq.Deployment, databaseName string, parts []string) {
+	key := deployment.Name + "/" + databaseName
+
+	switch {
+	case parts[0] == "stats" && r.Method == "GET":
+		writeJSON(w, s.DatabaseStats[key])
+	case parts[0] == "users" && len(parts) == 1 && r.Method == "GET":
+		users := s.DatabaseUsers[key]
+		if users == nil {
+			users = []mongohq.DatabaseUser{}
+		}
+		writeJSON(w, users)
+	case parts[0] == "users" && len(parts) == 1 && r.Method == "POST":
+		var params struct {
+			Username string `json:"username"`
+		}
+		json.NewDecoder(r.Body).Decode(&params)
+		s.DatabaseUsers[key] = append(s.DatabaseUsers[key], mongohq.DatabaseUser{Username: params.Username})
+		writeJSON(w, mongohq.OkResponse{Ok: 1})
+	case parts[0] == "users" && len(parts) == 2 && r.Method == "DELETE":
+		for i, user := range s.DatabaseUsers[key] {
+			if user.Username == parts[1] {
+				s.DatabaseUsers[key] = append(s.DatabaseUsers[key][:i], s.DatabaseUsers[key][i+1:]...)
+				writeJSON(w, mongohq.OkResponse{Ok: 1})
+				return
+			}
+		}
+		writeNotFound(w)
+	default:
+		writeNotFound(w)
+	}
+}
+
+func (s *Server) historicalLogs(w http.ResponseWriter, r *http.Request, deployment *mongohq.Deployment) {
+	search := r.URL.Query().Get("search")
+	exclude := r.URL.Query().Get("exclude")
+
+	result := map[string]map[string][]Log{}
+	hosts := []string{}
+	for host := range s.Logs[deployment.Name] {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	for _, host := range hosts {
+		logs := []Log{}
+		for _, log := range s.Logs[deployment.Name][host] {
+			if search != "" && !strings.Contains(log.Message, search) {
+				continue
+			}
+			if exclude != "" && strings.Contains(log.Message, exclude) {
+				continue
+			}
+			logs = append(logs, log)
+		}
+		result[host] = map[string][]Log{"logs": logs}
+	}
+	writeJSON(w, result)
+}
+
+var upgrader = websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+
+// socket acknowledges one subscription, sends the matching frames, then
+// holds the connection open until the client goes away.
+func (s *Server) socket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	var subscription mongohq.SocketMessage
+	if err := conn.ReadJSON(&subscription); err != nil {
+		return
+	}
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"uuid":"`+subscription.Uuid+`","message":"subscription successful"}`))
+
+	s.mu.Lock()
+	stats := s.Stats
+	oplog := s.Oplog
+	s.mu.Unlock()
+
+	switch subscription.Message.Type {
+	case "mongo.stats":
+		for _, frame := range stats {
+			conn.WriteJSON(mongohq.MongoStatMessage{Type: "mongo.stats", Ts: s.Now().UTC().Format(time.RFC3339), Message: frame})
+		}
+	case "mongo.oplog":
+		for _, entry := range oplog {
+			conn.WriteMessage(websocket.TextMessage, []byte(entry))
+		}
+	}
+
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) account(slug string) *mongohq.Account {
+	for i := range s.Accounts {
+		if s.Accounts[i].Slug == slug {
+			return &s.Accounts[i]
+		}
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(mongohq.ErrorResponse{Error: message})
+}
+
+func writeOauthError(w http.ResponseWriter, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
+
+func writeNotFound(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusNotFound)
+	w.Write([]byte("NOT FOUND"))
+}
@@ -0,0 +1,156 @@
+package mongohq
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DeviceCode is the start of a device-code login (RFC 8628): the user
+// visits VerificationUri and enters UserCode, while the CLI polls with
+// DeviceCode.
+type DeviceCode struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationUri         string `json:"verification_uri"`
+	VerificationUriComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// PollDeviceToken returns ErrAuthorizationPending until the user has
+// approved the login, and ErrSlowDown when polling too often.
+var ErrAuthorizationPending = errors.New("authorization_pending")
+var ErrSlowDown = errors.New("slow_down")
+
+type tokenArguments struct {
+	GrantType    string `json:"grant_type"`
+	ClientId     string `json:"client_id"`
+	Code         string `json:"code,omitempty"`
+	RedirectUri  string `json:"redirect_uri,omitempty"`
+	CodeVerifier string `json:"code_verifier,omitempty"`
+	DeviceCode   string `json:"device_code,omitempty"`
+}
+
+const deviceCodeGrant = "urn:ietf:params:oauth:grant-type:device_code"
+
+// AuthorizeUrl is the page to send a browser to for an authorization-code
+// login with PKCE (RFC 7636).  codeChallenge is the base64url SHA-256 of the
+// verifier later passed to ExchangeCode.
+func (api Api) AuthorizeUrl(redirectUri, state, codeChallenge string) string {
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", api.ClientId)
+	query.Set("redirect_uri", redirectUri)
+	query.Set("state", state)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	return api.apiUrl("/oauth/authorize") + "?" + query.Encode()
+}
+
+// ExchangeCode completes an authorization-code login, returning the oauth
+// token.
+func (api Api) ExchangeCode(ctx context.Context, code, redirectUri, codeVerifier string) (string, error) {
+	return api.requestToken(ctx, tokenArguments{GrantType: "authorization_code", ClientId: api.ClientId, Code: code, RedirectUri: redirectUri, CodeVerifier: codeVerifier})
+}
+
+func (api Api) RequestDeviceCode(ctx context.Context) (DeviceCode, error) {
+	var deviceCode DeviceCode
+
+	data, err := json.Marshal(map[string]string{"client_id": api.ClientId})
+	if err != nil {
+		return deviceCode, err
+	}
+
+	body, err := api.postOauth(ctx, "/oauth/device/code", data)
+	if err != nil {
+		return deviceCode, err
+	}
+
+	err = json.Unmarshal(body, &deviceCode)
+	if err == nil && deviceCode.DeviceCode == "" {
+		err = errors.New("Error starting device login: no device code returned.")
+	}
+	return deviceCode, err
+}
+
+func (api Api) PollDeviceToken(ctx context.Context, deviceCode string) (string, error) {
+	return api.requestToken(ctx, tokenArguments{GrantType: deviceCodeGrant, ClientId: api.ClientId, DeviceCode: deviceCode})
+}
+
+func (api Api) requestToken(ctx context.Context, arguments tokenArguments) (string, error) {
+	data, err := json.Marshal(arguments)
+	if err != nil {
+		return "", errors.New("Error creating MongoHQ authentication request.")
+	}
+
+	body, err := api.postOauth(ctx, "/oauth/token", data)
+	if err != nil {
+		return "", err
+	}
+
+	var tokenResponse struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(body, &tokenResponse); err != nil || tokenResponse.AccessToken == "" {
+		return "", errors.New("Error authenticating against MongoHQ: no token returned.")
+	}
+	return tokenResponse.AccessToken, nil
+}
+
+// postOauth posts to one of the /oauth endpoints, which are not
+// authenticated with a bearer token and answer failures with an OAuth
+// error code.
+func (api Api) postOauth(ctx context.Context, path string, data []byte) ([]byte, error) {
+	client, err := api.buildHttpClient()
+	if err != nil {
+		return nil, errors.New("Error building HTTPS transport process.")
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "POST", api.apiUrl(path), bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Add("User-Agent", api.UserAgent)
+	request.Header.Add("Content-Type", "application/json")
+
+	api.Trace.Request(request)
+	start := time.Now()
+	response, err := client.Do(request)
+	api.Trace.Response(request, response, err, time.Since(start))
+
+	if err != nil {
+		return nil, newNetworkError(request, err)
+	}
+
+	responseBody, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	api.Trace.Body("<", responseBody)
+
+	if response.StatusCode >= 400 {
+		var errorResponse struct {
+			Error            string `json:"error"`
+			ErrorDescription string `json:"error_description"`
+		}
+		_ = json.Unmarshal(responseBody, &errorResponse)
+
+		switch errorResponse.Error {
+		case ErrAuthorizationPending.Error():
+			return responseBody, ErrAuthorizationPending
+		case ErrSlowDown.Error():
+			return responseBody, ErrSlowDown
+		}
+
+		message := errorResponse.ErrorDescription
+		if message == "" {
+			message = errorResponse.Error
+		}
+		return responseBody, newStatusError(request, response.StatusCode, response.Status, message)
+	}
+	return responseBody, nil
+}
@@ -0,0 +1,119 @@
+package mongohq
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tracer logs HTTP and websocket traffic for --verbose and MONGOHQ_DEBUG.
+// A nil *Tracer is valid and logs nothing, so callers never check for it.
+type Tracer struct {
+	out io.Writer
+	mu  sync.Mutex
+}
+
+func NewTracer(out io.Writer) *Tracer {
+	return &Tracer{out: out}
+}
+
+const redacted = "[REDACTED]"
+
+var tokenParamRegex = regexp.MustCompile(`(?i)(token=)[^&]*`)
+var secretFieldRegex = regexp.MustCompile(`(?i)("(?:password|pwd|access_token|refresh_token|token|code|code_verifier|device_code)"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+
+func redactUrl(rawUrl string) string {
+	return tokenParamRegex.ReplaceAllString(rawUrl, "${1}"+redacted)
+}
+
+func redactBody(body []byte) string {
+	return secretFieldRegex.ReplaceAllString(string(body), `${1}"`+redacted+`"`)
+}
+
+func redactHeader(name, value string) string {
+	switch strings.ToLower(name) {
+	case "authorization":
+		if strings.HasPrefix(value, "Bearer ") {
+			return "Bearer " + redacted
+		}
+		return redacted
+	case "x-mongohq-otp":
+		if strings.HasPrefix(value, "required") {
+			return value
+		}
+		return redacted
+	}
+	return value
+}
+
+func (t *Tracer) printf(format string, args ...interface{}) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintf(t.out, format, args...)
+}
+
+func (t *Tracer) headers(prefix string, header http.Header) {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, value := range header[name] {
+			t.printf("%s %s: %s\n", prefix, name, redactHeader(name, value))
+		}
+	}
+}
+
+func (t *Tracer) Request(request *http.Request) {
+	if t == nil {
+		return
+	}
+	t.printf("> %s %s\n", request.Method, redactUrl(request.URL.String()))
+	t.headers(">", request.Header)
+
+	if request.GetBody != nil {
+		if body, err := request.GetBody(); err == nil {
+			data, _ := ioutil.ReadAll(body)
+			body.Close()
+			t.Body(">", data)
+		}
+	}
+}
+
+func (t *Tracer) Response(request *http.Request, response *http.Response, err error, elapsed time.Duration) {
+	if t == nil {
+		return
+	}
+	if err != nil {
+		t.printf("< %s %s failed after %s: %s\n", request.Method, redactUrl(request.URL.String()), elapsed, redactUrl(err.Error()))
+		return
+	}
+	t.printf("< %s (%s)\n", response.Status, elapsed)
+	t.headers("<", response.Header)
+}
+
+func (t *Tracer) Body(prefix string, body []byte) {
+	if t == nil || len(body) == 0 {
+		return
+	}
+	t.printf("%s %s\n", prefix, redactBody(body))
+}
+
+// Frame logs a websocket message; direction is ">" for sent, "<" for received.
+func (t *Tracer) Frame(direction string, message []byte) {
+	if len(message) == 0 {
+		return
+	}
+	t.printf("%s [ws %s] %s\n", direction, time.Now().Format("15:04:05.000"), redactBody(message))
+}
@@ -0,0 +1,40 @@
+package mongohq_test
+
+import (
+	"bytes"
+	"context"
+	"github.com/MongoHQ/mongohq-cli/mongohq"
+	"github.com/MongoHQ/mongohq-cli/mongohq/mongohqtest"
+	"strings"
+	"testing"
+)
+
+func TestTracerRedactsDatabaseUsers(t *testing.T) {
+	server := mongohqtest.NewServer()
+	defer server.Close()
+	server.DatabaseUsers["test-deployment/test-database"] = []mongohq.DatabaseUser{{Username: "app", PasswordHash: "3f4e5d6c7b8a"}}
+
+	var trace bytes.Buffer
+	api := server.Api()
+	api.Trace = mongohq.NewTracer(&trace)
+
+	users, err := api.GetDatabaseUsers(context.Background(), "test-deployment", "test-database")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].PasswordHash != "3f4e5d6c7b8a" {
+		t.Fatalf("got users %+v", users)
+	}
+	if _, err := api.CreateDatabaseUser(context.Background(), "test-deployment", "test-database", "reporting", "new-secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, secret := range []string{"3f4e5d6c7b8a", "new-secret", server.Token} {
+		if strings.Contains(trace.String(), secret) {
+			t.Errorf("trace shows %q:\n%s", secret, trace.String())
+		}
+	}
+	if !strings.Contains(trace.String(), `"pwd":"[REDACTED]"`) {
+		t.Errorf("trace does not show the redacted users response:\n%s", trace.String())
+	}
+}
@@ -1,6 +1,7 @@
-package main
+package mongohq
 
 import (
+	"context"
 	"encoding/json"
 )
 
@@ -10,8 +11,8 @@ type User struct {
 	Name  string `json:"name"`
 }
 
-func (api *Api) GetCurrentUser() (User, error) {
-	body, err := api.restGet(api.apiUrl("/user"))
+func (api *Api) GetCurrentUser(ctx context.Context) (User, error) {
+	body, err := api.restGet(ctx, api.apiUrl("/user"))
 
 	if err != nil {
 		return User{}, err
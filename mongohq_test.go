@@ -0,0 +1,311 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/MongoHQ/mongohq-cli/mongohq"
+	"github.com/MongoHQ/mongohq-cli/mongohq/mongohqtest"
+	"github.com/codegangsta/cli"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/*.golden with the output of this run")
+
+// testdata is the absolute path of the golden files, since tests run
+// commands from a scratch directory.
+var testdata string
+
+// exitCode is what the exit hook panics with, so that a command which
+// would end the process unwinds back to runCommand instead.
+type exitCode int
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+
+	var err error
+	if testdata, err = filepath.Abs("testdata"); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	exit = func(code int) { panic(exitCode(code)) }
+	cli.HelpPrinter = printHelpWithAliases(cli.HelpPrinter)
+	os.Exit(m.Run())
+}
+
+// isolate gives the test its own MONGOHQ_HOME and working directory, with
+// none of the MONGOHQ_* variables of whoever runs the tests.  It returns
+// the home directory.
+func isolate(t *testing.T) string {
+	for _, variable := range os.Environ() {
+		name := strings.SplitN(variable, "=", 2)[0]
+		if strings.HasPrefix(name, "MONGOHQ_") {
+			value := os.Getenv(name)
+			os.Unsetenv(name)
+			t.Cleanup(func() { os.Setenv(name, value) })
+		}
+	}
+
+	home := t.TempDir()
+	t.Setenv("MONGOHQ_HOME", home)
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(home); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(cwd) })
+
+	activeProfile = defaultProfile
+	initPaths()
+	return home
+}
+
+// newTestServer starts the fake API and points commands at it, logged in
+// with the server's token and defaulting to its account.
+func newTestServer(t *testing.T) *mongohqtest.Server {
+	isolate(t)
+	server := mongohqtest.NewServer()
+	t.Cleanup(server.Close)
+
+	t.Setenv("MONGOHQ_API_URL", server.URL)
+	t.Setenv("MONGOHQ_API_TOKEN", server.Token)
+	t.Setenv("MONGOHQ_ACCOUNT", "test-account")
+	t.Setenv("MONGOHQ_RETRY_BACKOFF", "1ms")
+	return server
+}
+
+type result struct {
+	status         int
+	stdout, stderr string
+}
+
+// runCommand runs `mongohq <args>` in process, as main does, and collects
+// what it wrote and the status it exited with.  stdin is empty, so the
+// command is not interactive.
+func runCommand(t *testing.T, args ...string) result {
+	stdin, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	return runCommandWithInput(t, stdin, args...)
+}
+
+func runCommandWithInput(t *testing.T, stdin *os.File, args ...string) result {
+	dir := t.TempDir()
+	stdout, err := os.Create(filepath.Join(dir, "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdout.Close()
+	stderr, err := os.Create(filepath.Join(dir, "stderr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stderr.Close()
+
+	savedStdin, savedStdout, savedStderr := os.Stdin, os.Stdout, os.Stderr
+	os.Stdin, os.Stdout, os.Stderr = stdin, stdout, stderr
+
+	status := 0
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				code, ok := r.(exitCode)
+				if !ok {
+					os.Stdin, os.Stdout, os.Stderr = savedStdin, savedStdout, savedStderr
+					panic(r)
+				}
+				status = int(code)
+			}
+		}()
+		runApp(newApp(), append([]string{"mongohq"}, args...))
+	}()
+	finishCommand()
+	os.Stdin, os.Stdout, os.Stderr = savedStdin, savedStdout, savedStderr
+
+	out, err := ioutil.ReadFile(stdout.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	errOut, err := ioutil.ReadFile(stderr.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result{status: status, stdout: string(out), stderr: string(errOut)}
+}
+
+// clock matches the time of day that streams such as mongostat end each
+// line with.
+var clock = regexp.MustCompile(`\b\d\d:\d\d:\d\d\n`)
+
+// golden renders a run the way testdata/*.golden files hold it, with the
+// fake server's address, the scratch home and the time of day replaced by
+// placeholders.
+func golden(args []string, r result, server *mongohqtest.Server, home string) string {
+	text := fmt.Sprintf("$ mongohq %s\nexit status %d\n-- stdout --\n%s-- stderr --\n%s", strings.Join(args, " "), r.status, r.stdout, r.stderr)
+	text = strings.Replace(text, server.URL, "{{server}}", -1)
+	text = strings.Replace(text, home, "{{home}}", -1)
+	return clock.ReplaceAllString(text, "{{time}}\n")
+}
+
+func checkGolden(t *testing.T, name, got string) {
+	path := filepath.Join(testdata, name+".golden")
+	if *update {
+		if err := ioutil.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v; run go test -update to create it", err)
+	}
+	if got != string(want) {
+		t.Errorf("output differs from %s; run go test -update to accept it\n--- got\n%s\n--- want\n%s", path, got, want)
+	}
+}
+
+var goldenTests = []struct {
+	name  string
+	args  []string
+	setup func(server *mongohqtest.Server)
+}{
+	// each command, in its default text output
+	{name: "accounts", args: []string{"accounts"}},
+	{name: "accounts_info", args: []string{"accounts:info", "--account", "test-account"}},
+	{name: "backups", args: []string{"backups"}},
+	{name: "backups_info", args: []string{"backups:info", "--backup", "b1"}},
+	{name: "databases_info", args: []string{"databases:info", "--deployment", "test-deployment", "--database", "test-database"}},
+	{name: "deployments", args: []string{"deployments"}},
+	{name: "deployments_info", args: []string{"deployments:info", "--deployment", "test-deployment"}},
+	{name: "deployments_create", args: []string{"deployments:create", "--deployment", "new-deployment", "--database", "new-database", "--location", "aws:us-east-1"}},
+	{name: "deployments_rename", args: []string{"deployments:rename", "--deployment", "test-deployment", "--name", "renamed-deployment"}},
+	{name: "databases_create", args: []string{"databases:create", "--deployment", "test-deployment", "--database", "new-database"}},
+	{name: "locations", args: []string{"locations"}},
+	{name: "logs", args: []string{"logs", "--deployment", "test-deployment"}},
+	{name: "users", args: []string{"users", "--deployment", "test-deployment", "--database", "test-database"}},
+	{name: "whoami", args: []string{"whoami"}},
+	{name: "auth_tokens", args: []string{"auth:tokens"}},
+	{name: "config_list", args: []string{"config:list", "--show-origin"}},
+	{name: "aliases", args: []string{"aliases"}},
+	{name: "profiles_list", args: []string{"profiles:list"}},
+	{name: "profiles_use", args: []string{"profiles:use", "--name", "staging"}},
+	{name: "backups_create", args: []string{"backups:create", "--deployment", "test-deployment"}},
+	{name: "backups_restore", args: []string{"backups:restore", "--backup", "b1", "--deployment", "restored", "--source-database", "test-database", "--destination-database", "restored-database"}},
+	{name: "databases_remove", args: []string{"databases:remove", "--deployment", "test-deployment", "--database", "test-database", "--force"}},
+	{name: "deployments_remove", args: []string{"deployments:remove", "--deployment", "test-deployment", "--force"}},
+	{name: "users_create", args: []string{"users:create", "--deployment", "test-deployment", "--database", "test-database", "--username", "reporting", "--password", "secret"}},
+	{name: "users_remove", args: []string{"users:remove", "--deployment", "test-deployment", "--database", "test-database", "--username", "app"}},
+	{name: "mongostat", args: []string{"--timeout", "500ms", "mongostat", "--deployment", "test-deployment"}},
+	{name: "auth_create", args: []string{"auth:create", "--description", "ci"}},
+	{name: "auth_revoke", args: []string{"auth:revoke", "--id", "auth1"}},
+	{name: "config_set", args: []string{"config:set", "--key", "format", "--value", "json"}},
+	{name: "config_get", args: []string{"config:get", "--key", "account"}},
+	{name: "config_account", args: []string{"config:account", "--account", "test-account"}},
+	{name: "aliases_set", args: []string{"aliases:set", "--name", "ls", "--command", "deployments --columns name,status"}},
+	{name: "aliases_remove", args: []string{"aliases:remove", "--name", "ls"}, setup: addAlias},
+	{name: "aliases_run", args: []string{"ls", "--sort", "-name"}, setup: addAlias},
+	{name: "help", args: []string{"help", "deployments:info"}},
+
+	// formats
+	{name: "format_json", args: []string{"--format", "json", "deployments:info", "--deployment", "test-deployment"}},
+	{name: "format_yaml", args: []string{"--format", "yaml", "deployments:info", "--deployment", "test-deployment"}},
+	{name: "format_table", args: []string{"--format", "table", "backups"}},
+	{name: "format_template", args: []string{"--template", `{{range .}}{{.Name}} on {{.Location}}{{"\n"}}{{end}}`, "deployments"}},
+	{name: "format_json_list", args: []string{"--format", "json", "accounts"}},
+	{name: "format_yaml_list", args: []string{"--format", "yaml", "backups"}},
+	{name: "format_unknown", args: []string{"--format", "xml", "deployments"}},
+
+	// deployment listings
+	{name: "deployments_columns", args: []string{"deployments", "--columns", "name,primary,members,databases"}, setup: addDeployments},
+	{name: "deployments_sort", args: []string{"deployments", "--sort", "-version"}, setup: addDeployments},
+	{name: "deployments_filters", args: []string{"deployments", "--status", "running", "--location", "aws:us-east-1"}, setup: addDeployments},
+	{name: "deployments_filter_list", args: []string{"deployments", "--plan", "elastic,dedicated", "--version", "2.6"}, setup: addDeployments},
+	{name: "deployments_filter_none", args: []string{"deployments", "--status", "deleted"}, setup: addDeployments},
+	{name: "deployments_summary", args: []string{"deployments", "--sort", "version"}, setup: func(server *mongohqtest.Server) {
+		addDeployments(server)
+		server.SummaryListings = true
+	}},
+	{name: "deployments_all_accounts", args: []string{"--format", "json", "deployments", "--all-accounts"}, setup: addDeployments},
+	{name: "deployments_unknown_column", args: []string{"deployments", "--columns", "name,size"}},
+
+	// choosing a default account on first use
+	{name: "account_default_json", args: []string{"--format", "json", "deployments"}, setup: withoutAccount},
+	{name: "account_none", args: []string{"deployments"}, setup: func(server *mongohqtest.Server) {
+		withoutAccount(server)
+		server.Accounts = nil
+	}},
+	{name: "account_auth_expired", args: []string{"--token", "revoked-token", "deployments"}, setup: withoutAccount},
+	{name: "account_network", args: []string{"--api-url", "http://127.0.0.1:1", "--retries", "1", "deployments"}, setup: withoutAccount},
+
+	// exit codes
+	{name: "exit_general", args: []string{"deploymnts"}},
+	{name: "exit_validation", args: []string{"deployments:create", "--deployment", "new-deployment", "--database", "new-database", "--location", ""}},
+	{name: "exit_not_found", args: []string{"deployments:info", "--deployment", "missing"}},
+	{name: "exit_server", args: []string{"--retries", "1", "accounts"}, setup: func(server *mongohqtest.Server) {
+		server.Fail = map[string]int{"GET /accounts": 503}
+	}},
+	{name: "exit_network", args: []string{"--api-url", "http://127.0.0.1:1", "--retries", "1", "accounts"}},
+	{name: "exit_auth_expired", args: []string{"--token", "revoked-token", "accounts"}},
+	{name: "exit_timeout", args: []string{"--timeout", "1ns", "accounts"}},
+}
+
+// addDeployments gives the account deployments that differ in each column
+// a listing can be sorted or filtered by, and a second account.
+func addDeployments(server *mongohqtest.Server) {
+	server.Deployments["test-account"] = append(server.Deployments["test-account"],
+		mongohq.Deployment{Id: "d2", Name: "staging", Plan: "dedicated", Location: "rackspace:dfw", Status: "running", Version: "2.4.10",
+			CurrentPrimary: "c0.staging.mongohq.com:10000", Members: []string{"c0.staging.mongohq.com:10000"}},
+		mongohq.Deployment{Id: "d3", Name: "archive", Plan: "elastic", Location: "aws:us-east-1", Status: "stopped", Version: "2.6.10",
+			CurrentPrimary: "c0.archive.mongohq.com:10000", Members: []string{"c0.archive.mongohq.com:10000"}},
+	)
+	server.Accounts = append(server.Accounts, mongohq.Account{Id: "a2", Name: "Other Account", Slug: "other-account", Active: true})
+	server.Deployments["other-account"] = []mongohq.Deployment{
+		{Id: "d4", Name: "other", Plan: "elastic", Location: "aws:us-east-1", Status: "running", Version: "2.6.3"},
+	}
+}
+
+// withoutAccount leaves the account to be chosen by RequireAccount.
+func withoutAccount(server *mongohqtest.Server) {
+	os.Unsetenv("MONGOHQ_ACCOUNT")
+}
+
+func addAlias(server *mongohqtest.Server) {
+	updateConfigFile(aliasFile, func(config *Config) error {
+		config.Aliases = map[string]string{"ls": "deployments --columns name,status"}
+		return nil
+	})
+}
+
+func TestGolden(t *testing.T) {
+	for _, test := range goldenTests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t)
+			if test.setup != nil {
+				test.setup(server)
+			}
+
+			r := runCommand(t, test.args...)
+			checkGolden(t, test.name, golden(test.args, r, server, os.Getenv("MONGOHQ_HOME")))
+		})
+	}
+}
+
+func TestLoginRequired(t *testing.T) {
+	server := newTestServer(t)
+	os.Unsetenv("MONGOHQ_API_TOKEN")
+
+	args := []string{"accounts"}
+	r := runCommand(t, args...)
+	checkGolden(t, "exit_login_required", golden(args, r, server, os.Getenv("MONGOHQ_HOME")))
+}
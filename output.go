@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/MongoHQ/mongohq-cli/mongohq"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+)
+
+const (
+	formatText  = "text"
+	formatJson  = "json"
+	formatYaml  = "yaml"
+	formatTable = "table"
+
+	// formatTemplate is not a --format value; it is picked by --template.
+	formatTemplate = "template"
+)
+
+// formatSetting reads --format.  The default, text, is the original
+// "== Header" output.
+func formatSetting(format, templateText string) (string, *template.Template, error) {
+	if templateText != "" {
+		if format != "" {
+			return "", nil, errors.New("--format and --template cannot be used together")
+		}
+		outputTemplate, err := template.New("output").Funcs(templateFuncs).Parse(templateText)
+		if err != nil {
+			return "", nil, fmt.Errorf("Error parsing --template: %s", err.Error())
+		}
+		return formatTemplate, outputTemplate, nil
+	}
+
+	switch format {
+	case "":
+		return formatText, nil, nil
+	case formatText, formatJson, formatYaml, formatTable:
+		return format, nil, nil
+	}
+	return "", nil, errors.New("Format must be one of text, json, yaml or table")
+}
+
+// Values for the color setting.  With auto, errors are colored when stderr
+// is a terminal and NO_COLOR is not set.
+const (
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
+// colorErrors makes reportError print errors in red.
+var colorErrors bool
+
+func colorSetting(color string) (bool, error) {
+	switch color {
+	case "", colorAuto:
+		if os.Getenv("NO_COLOR") != "" {
+			return false, nil
+		}
+		stat, err := os.Stderr.Stat()
+		return err == nil && stat.Mode()&os.ModeCharDevice != 0, nil
+	case colorAlways:
+		return true, nil
+	case colorNever:
+		return false, nil
+	}
+	return false, errors.New("Color must be one of auto, always or never")
+}
+
+// templateFuncs are available to --template, on top of the text/template
+// builtins.
+var templateFuncs = template.FuncMap{
+	"prettySize":     templatePrettySize,
+	"formatHostname": mongohq.FormatHostname,
+	"join":           strings.Join,
+	"formatTime":     templateFormatTime,
+}
+
+// templatePrettySize takes any of the number types found in the mongohq
+// structs, as sizes are int in some and float64 in others.
+func templatePrettySize(size interface{}) (string, error) {
+	switch size := size.(type) {
+	case int:
+		return mongohq.PrettySize(float64(size)), nil
+	case int64:
+		return mongohq.PrettySize(float64(size)), nil
+	case float64:
+		return mongohq.PrettySize(size), nil
+	}
+	return "", fmt.Errorf("prettySize: %v is not a number", size)
+}
+
+// templateFormatTime formats either a time.Time or one of the RFC 3339
+// timestamp strings the API returns, such as Backup.CreatedAt, with a Go
+// time layout: {{formatTime "Jan 2 15:04" .CreatedAt}}.
+func templateFormatTime(layout string, value interface{}) (string, error) {
+	switch value := value.(type) {
+	case time.Time:
+		return value.Format(layout), nil
+	case string:
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return "", fmt.Errorf("formatTime: %s", err.Error())
+		}
+		return parsed.Format(layout), nil
+	}
+	return "", fmt.Errorf("formatTime: %v is not a time", value)
+}
+
+// table is the --format table rendering of a result: one row per item,
+// with columns aligned.
+type table struct {
+	headers []string
+	rows    [][]string
+}
+
+func (t *table) add(row ...string) {
+	t.rows = append(t.rows, row)
+}
+
+func (t table) write(out io.Writer) error {
+	writer := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, strings.Join(t.headers, "\t"))
+	for _, row := range t.rows {
+		fmt.Fprintln(writer, strings.Join(row, "\t"))
+	}
+	return writer.Flush()
+}
+
+// render writes the result of a read command for any format but text.  JSON
+// and YAML carry the full value, using the json field names of the mongohq
+// structs, so scripts can rely on them.  A --template is executed against
+// the same value, so it uses the Go field names instead.
+func (c *Controller) render(value interface{}, rows table) error {
+	switch c.Format {
+	case formatJson:
+		encoder := json.NewEncoder(c.Out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	case formatYaml:
+		return writeYaml(c.Out, value)
+	case formatTable:
+		return rows.write(c.Out)
+	case formatTemplate:
+		if err := c.Template.Execute(c.Out, value); err != nil {
+			return fmt.Errorf("Error rendering --template: %s", err.Error())
+		}
+		return nil
+	}
+	return fmt.Errorf("Unknown format %s", c.Format)
+}
+
+// writeYaml goes through encoding/json, so that field names and their order
+// are the same as for --format json.
+func writeYaml(out io.Writer, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	node, err := decodeYamlNode(decoder)
+	if err != nil {
+		return err
+	}
+
+	encoder := yaml.NewEncoder(out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// yaml11Bools are plain strings in YAML 1.2 but booleans to the YAML 1.1
+// parsers many tools still use, so they are always quoted.
+var yaml11Bools = map[string]bool{"yes": true, "no": true, "on": true, "off": true, "y": true, "n": true}
+
+// decodeYamlNode decodes one JSON value into a YAML node, keeping object
+// keys in order.  Scalars are tagged with their JSON type, so the encoder
+// quotes strings that would otherwise read back as something else.
+func decodeYamlNode(decoder *json.Decoder) (*yaml.Node, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token := token.(type) {
+	case json.Delim:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		if token == '{' {
+			node = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		}
+		for decoder.More() {
+			if node.Kind == yaml.MappingNode {
+				key, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: fmt.Sprint(key)})
+			}
+			child, err := decodeYamlNode(decoder)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		_, err = decoder.Token()
+		return node, err
+	case string:
+		node := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: token}
+		if yaml11Bools[strings.ToLower(token)] {
+			node.Style = yaml.DoubleQuotedStyle
+		}
+		return node, nil
+	case json.Number:
+		if _, err := token.Int64(); err == nil {
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: token.String()}, nil
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: token.String()}, nil
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(token)}, nil
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+}
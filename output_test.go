@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"gopkg.in/yaml.v3"
+	"reflect"
+	"testing"
+)
+
+type yamlTestDeployment struct {
+	Name      string            `json:"name"`
+	Port      int               `json:"port"`
+	Ratio     float64           `json:"ratio"`
+	Primary   *yamlTestMember   `json:"primary"`
+	Members   []yamlTestMember  `json:"members"`
+	Databases []string          `json:"databases"`
+	Labels    map[string]string `json:"labels"`
+	Nothing   []string          `json:"nothing"`
+}
+
+type yamlTestMember struct {
+	Host   string `json:"host"`
+	Hidden bool   `json:"hidden"`
+}
+
+// yamlTestValue covers nested structs, empty and nil collections, and
+// strings that YAML would read as something else if written plain.
+var yamlTestValue = []interface{}{
+	yamlTestDeployment{
+		Name:    "test-deployment",
+		Port:    10000,
+		Ratio:   0.25,
+		Primary: &yamlTestMember{Host: "c0.test.mongohq.com:10000"},
+		Members: []yamlTestMember{
+			{Host: "c0.test.mongohq.com:10000"},
+			{Host: "c1.test.mongohq.com:10001", Hidden: true},
+		},
+		Databases: []string{},
+		Labels:    map[string]string{},
+	},
+	map[string]interface{}{
+		"strings": []string{
+			"true", "False", "yes", "no", "on", "off", "y", "n", "null", "~", "",
+			"1", "0x1F", "1e3", "2.6", ".inf", "-.NaN", "2014-07-01",
+			"- item", "key: value", "# comment", "&anchor", "*alias", "!tag", "%directive", "@at", "`tick",
+			"{flow}", "[flow]", "'single'", "\"double\"", "| block", "> folded", "?", ": colon",
+			" leading space", "trailing space ", "two\nlines", "tab\there", "unicode é",
+		},
+		"empty": map[string]interface{}{},
+	},
+}
+
+func TestWriteYaml(t *testing.T) {
+	var out bytes.Buffer
+	if err := writeYaml(&out, yamlTestValue); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "yaml", out.String())
+
+	// whatever the quoting, the YAML must read back as the JSON does
+	data, err := json.Marshal(yamlTestValue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fromJson, fromYaml interface{}
+	if err := json.Unmarshal(data, &fromJson); err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal(out.Bytes(), &fromYaml); err != nil {
+		t.Fatalf("output is not valid YAML: %v", err)
+	}
+	if !reflect.DeepEqual(normalizeYamlNumbers(fromYaml), fromJson) {
+		t.Errorf("YAML reads back as\n%#v\nbut the JSON is\n%#v", fromYaml, fromJson)
+	}
+}
+
+// normalizeYamlNumbers converts the ints yaml.v3 decodes into the float64s
+// encoding/json uses, so the two decodings can be compared.
+func normalizeYamlNumbers(value interface{}) interface{} {
+	switch value := value.(type) {
+	case int:
+		return float64(value)
+	case []interface{}:
+		for i := range value {
+			value[i] = normalizeYamlNumbers(value[i])
+		}
+	case map[string]interface{}:
+		for key := range value {
+			value[key] = normalizeYamlNumbers(value[key])
+		}
+	}
+	return value
+}
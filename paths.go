@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Files follow the XDG base directory layout: settings and credentials in
+// $XDG_CONFIG_HOME/mongohq and the shell's history in
+// $XDG_STATE_HOME/mongohq.  Earlier releases kept everything in ~/.mongohq,
+// which is moved the first time a command runs.  MONGOHQ_HOME puts both in
+// one directory instead, such as a sandbox for tests.
+var configPath, statePath string
+
+var historyfn string
+
+func initPaths() {
+	if home := os.Getenv("MONGOHQ_HOME"); home != "" {
+		setPaths(home, home)
+		return
+	}
+
+	home, _ := os.UserHomeDir()
+	config := xdgPath("XDG_CONFIG_HOME", home, ".config")
+	state := xdgPath("XDG_STATE_HOME", home, ".local/state")
+
+	legacy := filepath.Join(home, ".mongohq")
+	if !migrateLegacyHome(legacy, config, state) {
+		config, state = legacy, legacy
+	}
+	setPaths(config, state)
+}
+
+// xdgPath is our directory under an XDG base directory.  As the spec asks,
+// a relative path in the variable is ignored.
+func xdgPath(variable, home, fallback string) string {
+	base := os.Getenv(variable)
+	if base == "" || !filepath.IsAbs(base) {
+		base = filepath.Join(home, fallback)
+	}
+	return filepath.Join(base, "mongohq")
+}
+
+func setPaths(config, state string) {
+	configPath, statePath = config, state
+	profileFile = configPath + "/profile"
+	aliasFile = configPath + "/defaults"
+	historyfn = statePath + "/history"
+	useProfile(activeProfile)
+}
+
+// migrateLegacyHome moves ~/.mongohq to the config directory, and its
+// history on to the state directory.  It reports false when the old
+// directory could not be moved, such as onto another filesystem, and
+// should carry on being used.  Once the config directory exists, the old
+// one is left alone.
+func migrateLegacyHome(legacy, config, state string) bool {
+	if _, err := os.Stat(legacy); err != nil {
+		return true
+	} else if _, err := os.Stat(config); err == nil {
+		return true
+	}
+
+	err := os.MkdirAll(filepath.Dir(config), 0700)
+	if err == nil {
+		err = os.Rename(legacy, config)
+	}
+	if err != nil {
+		// another command may have moved it first
+		_, err := os.Stat(config)
+		return err == nil
+	}
+	fmt.Fprintln(os.Stderr, "Moved "+legacy+" to "+config+".")
+
+	if _, err := os.Stat(config + "/history"); err == nil {
+		if ensurePrivateDir(state) == nil && os.Rename(config+"/history", state+"/history") == nil {
+			fmt.Fprintln(os.Stderr, "Moved the shell history to "+state+".")
+		}
+	}
+	return true
+}
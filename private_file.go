@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// The defaults and credentials files are private to the user, and may be
+// written by several mongohq commands at once, such as two terminals both
+// choosing a default account.  Writes go to a temporary file that is
+// renamed over the old one, so a reader never sees half a file, and
+// changes that read the file first hold an advisory lock while they do.
+
+// lockTimeout bounds the wait for another command to finish writing.
+var lockTimeout = 10 * time.Second
+
+// lockFile takes the lock for changing path.  It is held on path.lock,
+// which is left in place, as the file itself is replaced by each write.
+// Where the platform has no advisory locks, lockFile always succeeds.
+func lockFile(path string) (unlock func(), err error) {
+	if err := ensurePrivateDir(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("Error locking %s: %w", path, err)
+	}
+
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		locked, err := tryLock(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("Error locking %s: %w", path, err)
+		} else if locked {
+			return func() {
+				unlockFile(file)
+				file.Close()
+			}, nil
+		}
+
+		if time.Now().After(deadline) {
+			file.Close()
+			return nil, errors.New("Timed out waiting for another mongohq command to finish writing " + path + ".")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// writeFileAtomic replaces path with data, readable only by the user.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := ensurePrivateDir(dir); err != nil {
+		return err
+	}
+
+	temp, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	// once renamed, there is nothing left to remove
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Chmod(perm); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	// Windows will not rename over a read-only file, such as the
+	// credentials file from earlier releases
+	if runtime.GOOS == "windows" {
+		os.Chmod(path, perm)
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+func ensurePrivateDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errors.New("Error creating directory " + dir)
+	}
+	repairPermissions(dir, 0700)
+	return nil
+}
+
+// repairPermissions resets a private file or directory that other users
+// can read, or that the user cannot write, as with the read-only
+// credentials file from earlier releases.  Other users having been able to
+// read a file is worth a warning, as it may hold a token.
+func repairPermissions(path string, perm os.FileMode) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	mode := info.Mode().Perm()
+	if mode&0077 == 0 && mode&0600 == 0600 {
+		return
+	}
+
+	if err := os.Chmod(path, perm); err == nil && mode&0077 != 0 && !info.IsDir() {
+		fmt.Fprintf(os.Stderr, "Warning: %s could be read by other users.  Its permissions have been reset to %#o.\n", path, perm)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLockFileTimesOut(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "defaults")
+	unlock, err := lockFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(timeout time.Duration) { lockTimeout = timeout }(lockTimeout)
+	lockTimeout = 100 * time.Millisecond
+	if second, err := lockFile(path); err == nil {
+		second()
+		t.Fatal("took a lock that was already held")
+	} else if !strings.Contains(err.Error(), "Timed out waiting for another mongohq command") {
+		t.Fatalf("got error %v", err)
+	}
+
+	unlock()
+	second, err := lockFile(path)
+	if err != nil {
+		t.Fatalf("lock was not released: %v", err)
+	}
+	second()
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mongohq")
+	path := filepath.Join(dir, "defaults")
+	for _, text := range []string{"first", "second"} {
+		if err := writeFileAtomic(path, []byte(text), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if data, err := ioutil.ReadFile(path); err != nil || string(data) != text {
+			t.Errorf("read %q, %v after writing %q", data, err, text)
+		}
+	}
+
+	if stat, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if stat.Mode().Perm() != 0600 {
+		t.Errorf("%s has mode %v, want 0600", path, stat.Mode().Perm())
+	}
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("%s holds %d files, want only the one written", dir, len(entries))
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+type Profile struct {
+	Name        string `json:"name"`
+	Email       string `json:"email"`
+	AccountSlug string `json:"account-slug"`
+	Active      bool   `json:"active"`
+}
+
+func readProfile(name string) Profile {
+	profile := Profile{Name: name, Active: name == activeProfile}
+
+	config := readConfig(profilePath(name) + "/defaults")
+	profile.AccountSlug = config.AccountSlug
+	profile.Email = config.Email
+
+	// logins from before the email was kept in the defaults
+	if profile.Email == "" {
+		if creds, err := (plaintextStore{}).Load(name); err == nil {
+			profile.Email = creds.Email
+		}
+	}
+	return profile
+}
+
+func (c *Controller) ListProfiles() error {
+	var profiles []Profile
+	for _, name := range profileNames() {
+		profiles = append(profiles, readProfile(name))
+	}
+
+	if c.Format != formatText {
+		rows := table{headers: []string{"NAME", "EMAIL", "ACCOUNT", "ACTIVE"}}
+		for _, profile := range profiles {
+			rows.add(profile.Name, profile.Email, profile.AccountSlug, strconv.FormatBool(profile.Active))
+		}
+		return c.render(profiles, rows)
+	}
+
+	fmt.Fprintln(c.Out, "== Profiles")
+	for _, profile := range profiles {
+		line := profile.Name
+		if profile.Email == "" {
+			line += " (not logged in)"
+		} else {
+			line += " (" + profile.Email + ")"
+		}
+		if profile.Active {
+			line += " (active)"
+		}
+		fmt.Fprintln(c.Out, line)
+	}
+	return nil
+}
+
+func (c *Controller) UseProfile(name string) error {
+	if err := validateProfileName(name); err != nil {
+		return err
+	}
+
+	if err := setSelectedProfile(name); err != nil {
+		return fmt.Errorf("Error selecting profile: %w", err)
+	}
+
+	fmt.Fprintln(c.Out, "Now using profile "+name+".")
+	if readProfile(name).Email == "" {
+		fmt.Fprintln(c.Out, "It is not logged in yet; the next command will ask for your MongoHQ credentials.")
+	}
+	return nil
+}
+
+func (c *Controller) RemoveProfile(name string) error {
+	if err := validateProfileName(name); err != nil {
+		return err
+	}
+	if name == defaultProfile {
+		return errors.New("The default profile cannot be removed.  To remove its stored credentials, run `mongohq logout`.")
+	}
+
+	selected := getSelectedProfile() == name
+	if _, err := os.Stat(profilePath(name)); os.IsNotExist(err) && !selected {
+		return errors.New("No profile named " + name + ".")
+	}
+
+	// credentials outside the profile's directory, as in the Secret
+	// Service, would otherwise log in a new profile of the same name
+	if storeName := readConfig(profilePath(name) + "/defaults").CredentialStore; storeName != "" {
+		store, err := credentialStoreFor(storeName)
+		if err != nil {
+			return err
+		}
+		if err := store.Delete(name); err != nil {
+			return fmt.Errorf("Error removing the profile's credentials, so it has been kept: %w", err)
+		}
+	}
+
+	if err := os.RemoveAll(profilePath(name)); err != nil {
+		return fmt.Errorf("Error removing profile: %w", err)
+	}
+
+	if selected {
+		if err := setSelectedProfile(defaultProfile); err != nil {
+			return fmt.Errorf("Error selecting the default profile: %w", err)
+		}
+	}
+
+	fmt.Fprintln(c.Out, "Removed profile "+name+".")
+	return nil
+}
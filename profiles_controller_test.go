@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+// fakeStore records the profiles it is asked to delete, and fails with
+// deleteErr when it is set.
+type fakeStore struct {
+	deleted   []string
+	deleteErr error
+}
+
+func (s *fakeStore) Load(profile string) (credentials, error) {
+	return credentials{}, errNoCredentials
+}
+
+func (s *fakeStore) Save(profile string, creds credentials) error {
+	return nil
+}
+
+func (s *fakeStore) Delete(profile string) error {
+	s.deleted = append(s.deleted, profile)
+	return s.deleteErr
+}
+
+func TestRemoveProfileDeletesCredentials(t *testing.T) {
+	isolate(t)
+	store := &fakeStore{}
+	defer func(saved credentialStore) { credentialStores[storeSecretService] = saved }(credentialStores[storeSecretService])
+	credentialStores[storeSecretService] = store
+
+	if err := updateConfigFile(profilePath("staging")+"/defaults", func(config *Config) error {
+		config.CredentialStore = storeSecretService
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	store.deleteErr = errors.New("locked")
+	r := runCommand(t, "profiles:remove", "--name", "staging")
+	if r.status == 0 {
+		t.Errorf("removed the profile though its credentials could not be deleted")
+	}
+	if _, err := os.Stat(profilePath("staging")); err != nil {
+		t.Errorf("profile was removed without its credentials: %v", err)
+	}
+
+	store.deleted, store.deleteErr = nil, nil
+	if r := runCommand(t, "profiles:remove", "--name", "staging"); r.status != 0 {
+		t.Fatalf("exited %d: %s", r.status, r.stderr)
+	}
+	if len(store.deleted) != 1 || store.deleted[0] != "staging" {
+		t.Errorf("deleted credentials for %q, want staging", store.deleted)
+	}
+	if _, err := os.Stat(profilePath("staging")); !os.IsNotExist(err) {
+		t.Errorf("profile directory is still there: %v", err)
+	}
+}
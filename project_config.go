@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A project config file sits in a repository and holds the defaults for
+// working in it, such as which deployment it talks to.  It is found by
+// walking up from the working directory, and its settings win over the
+// profile's defaults.  api-url is left out, so a checked out repository
+// cannot send your token somewhere else.
+var projectConfigNames = []string{".mongohq.json", ".mongohq.yml", ".mongohq.yaml"}
+
+var projectConfigKeys = []string{"account", "deployment", "database", "format", "color", "timeout"}
+
+type ProjectConfig struct {
+	Path     string
+	Settings map[string]string
+	Aliases  map[string]string
+}
+
+// projectConfig is the project file for the current command, loaded by
+// setupCommand.  It is nil outside of a project.
+var projectConfig *ProjectConfig
+
+// findProjectConfig returns the nearest project file, or nil when there is
+// none between the working directory and the root.
+func findProjectConfig() (*ProjectConfig, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, nil
+	}
+
+	for {
+		for _, name := range projectConfigNames {
+			path := filepath.Join(dir, name)
+			if stat, err := os.Stat(path); err == nil && !stat.IsDir() {
+				return readProjectConfig(path)
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+func readProjectConfig(path string) (*ProjectConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %s: %w", path, err)
+	}
+
+	var values map[string]interface{}
+	if strings.HasSuffix(path, ".json") {
+		err = json.Unmarshal(data, &values)
+	} else {
+		err = yaml.Unmarshal(data, &values)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %s: %s", path, err.Error())
+	}
+
+	project := &ProjectConfig{Path: path, Settings: map[string]string{}, Aliases: map[string]string{}}
+	for name, value := range values {
+		if name == "aliases" {
+			aliases, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("Error reading %s: aliases must map names to commands", path)
+			}
+			for alias, command := range aliases {
+				text, ok := command.(string)
+				if !ok {
+					return nil, fmt.Errorf("Error reading %s: alias %s must be a command line", path, alias)
+				}
+				project.Aliases[alias] = text
+			}
+			continue
+		}
+
+		if !stringInSlice(name, projectConfigKeys) {
+			return nil, fmt.Errorf("Error reading %s: unknown key %s; project files may set %s and aliases", path, name, strings.Join(projectConfigKeys, ", "))
+		}
+		text, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("Error reading %s: %s must be a string", path, name)
+		}
+		project.Settings[name] = text
+	}
+	return project, nil
+}
+
+func stringInSlice(value string, values []string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
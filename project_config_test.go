@@ -0,0 +1,139 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var projectConfigTests = []struct {
+	name     string
+	file     string
+	text     string
+	settings map[string]string
+	aliases  map[string]string
+	err      string
+}{
+	{
+		name:     "plain",
+		file:     ".mongohq.yml",
+		text:     "deployment: orders-production\ndatabase: orders\n",
+		settings: map[string]string{"deployment": "orders-production", "database": "orders"},
+	},
+	{
+		name:     "quoting",
+		file:     ".mongohq.yml",
+		text:     "deployment: \"orders: production\"\ndatabase: 'it''s'\nformat: \"tab\\tle\"\n",
+		settings: map[string]string{"deployment": "orders: production", "database": "it's", "format": "tab\tle"},
+	},
+	{
+		name:     "empty string",
+		file:     ".mongohq.yml",
+		text:     "database: \"\"\ndeployment: ''\n",
+		settings: map[string]string{"database": "", "deployment": ""},
+	},
+	{
+		name:     "comments",
+		file:     ".mongohq.yaml",
+		text:     "---\n# defaults for this repository\ndeployment: orders # the primary\n\ndatabase: \"orders # not a comment\"\n",
+		settings: map[string]string{"deployment": "orders", "database": "orders # not a comment"},
+	},
+	{
+		name:     "aliases",
+		file:     ".mongohq.yml",
+		text:     "deployment: orders\naliases:\n  stat: mongostat\n  lsdb: \"deployments --format json\"\ntimeout: 30s\n",
+		settings: map[string]string{"deployment": "orders", "timeout": "30s"},
+		aliases:  map[string]string{"stat": "mongostat", "lsdb": "deployments --format json"},
+	},
+	{
+		name:     "flow aliases",
+		file:     ".mongohq.yml",
+		text:     "aliases: {stat: mongostat, ls: deployments}\n",
+		settings: map[string]string{},
+		aliases:  map[string]string{"stat": "mongostat", "ls": "deployments"},
+	},
+	{
+		name:     "json",
+		file:     ".mongohq.json",
+		text:     `{"deployment": "orders", "aliases": {"stat": "mongostat"}}`,
+		settings: map[string]string{"deployment": "orders"},
+		aliases:  map[string]string{"stat": "mongostat"},
+	},
+	{
+		name:     "empty file",
+		file:     ".mongohq.yml",
+		text:     "# nothing yet\n",
+		settings: map[string]string{},
+	},
+	{
+		name: "tab indentation",
+		file: ".mongohq.yml",
+		text: "aliases:\n\tstat: mongostat\n",
+		err:  "found character that cannot start any token",
+	},
+	{
+		name: "indentation without a parent",
+		file: ".mongohq.yml",
+		text: "deployment: orders\n  database: orders\n",
+		err:  "yaml: line 2",
+	},
+	{
+		name: "api-url",
+		file: ".mongohq.yml",
+		text: "api-url: https://example.com\n",
+		err:  "unknown key api-url",
+	},
+	{
+		name: "not a string",
+		file: ".mongohq.yml",
+		text: "timeout: 30\n",
+		err:  "timeout must be a string",
+	},
+	{
+		name: "aliases not a mapping",
+		file: ".mongohq.yml",
+		text: "aliases: mongostat\n",
+		err:  "aliases must map names to commands",
+	},
+	{
+		name: "alias not a command line",
+		file: ".mongohq.yml",
+		text: "aliases:\n  stat: [mongostat]\n",
+		err:  "alias stat must be a command line",
+	},
+}
+
+func TestReadProjectConfig(t *testing.T) {
+	for _, test := range projectConfigTests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), test.file)
+			if err := ioutil.WriteFile(path, []byte(test.text), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			project, err := readProjectConfig(path)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want one containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(project.Settings, test.settings) {
+				t.Errorf("settings are %v, want %v", project.Settings, test.settings)
+			}
+			aliases := test.aliases
+			if aliases == nil {
+				aliases = map[string]string{}
+			}
+			if !reflect.DeepEqual(project.Aliases, aliases) {
+				t.Errorf("aliases are %v, want %v", project.Aliases, aliases)
+			}
+		})
+	}
+}
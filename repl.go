@@ -1,12 +1,15 @@
 package main
 
 import (
+	"bytes"
 	"code.google.com/p/gopass"
+	"context"
+	"errors"
 	"fmt"
+	"github.com/MongoHQ/mongohq-cli/mongohq"
 	"github.com/codegangsta/cli"
 	"github.com/peterh/liner"
 	"os"
-	"os/signal"
 	"strings"
 )
 
@@ -36,7 +39,13 @@ func repl(app *cli.App) {
 		plines = append(plines, "")
 		copy(plines[1:], plines[0:])
 		plines[0] = "mongohq-repl"
-		app.Run(plines)
+		args, err := applyEnvironment(app, expandAlias(app, plines, commandAliases()))
+		if err != nil {
+			reportError(err)
+			continue
+		}
+		app.Run(args)
+		finishCommand()
 	}
 
 }
@@ -57,14 +66,6 @@ func safeGetPass(prompt string) (passwd string, err error) {
 
 func initTerm() {
 	term = liner.NewLiner()
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	go func() {
-		<-c
-		closeTerm()
-		fmt.Println("Quitting shell")
-		os.Exit(1)
-	}()
 
 	if f, err := os.Open(historyfn); err == nil {
 		term.ReadHistory(f)
@@ -86,6 +87,9 @@ func initTerm() {
 			for _, cmd := range myapp.Commands {
 				c = append(c, cmd.Name)
 			}
+			for _, alias := range userAliases() {
+				c = append(c, alias.Name)
+			}
 
 		case len(parts) == 1:
 			// One item - if it is help then offer help for all commands
@@ -99,6 +103,11 @@ func initTerm() {
 						c = append(c, cmd.Name)
 					}
 				}
+				for _, alias := range userAliases() {
+					if strings.HasPrefix(alias.Name, line) {
+						c = append(c, alias.Name)
+					}
+				}
 			}
 
 		case len(parts) == 2:
@@ -116,17 +125,65 @@ func initTerm() {
 }
 
 func closeTerm() {
-	if f, err := os.Create(historyfn); err != nil {
+	var history bytes.Buffer
+	term.WriteHistory(&history)
+	if err := writeFileAtomic(historyfn, history.Bytes(), 0600); err != nil {
 		fmt.Println("Error writing history file", err)
-	} else {
-		term.WriteHistory(f)
-		f.Close()
 	}
 	term.Close()
 }
 
-func cliOSExit() {
+// Exit codes, so scripts can tell failures apart.
+const (
+	exitError        = 1
+	exitValidation   = 2
+	exitNotFound     = 3
+	exitUnauthorized = 4
+	exitServer       = 5
+	exitNetwork      = 6
+	exitAuthExpired  = 7
+	exitTimeout      = 124
+	exitInterrupted  = 130
+)
+
+// exit is os.Exit, swapped out by tests that run commands in process.
+var exit = os.Exit
+
+// cliOSExitWithError exits with the code matching the category of an
+// APIError, or the generic error code for anything else.
+func cliOSExitWithError(err error) {
 	if !replMode {
-		os.Exit(1)
+		exit(exitCodeFor(err))
+	}
+}
+
+func exitCodeFor(err error) int {
+	if errors.Is(err, context.Canceled) {
+		return exitInterrupted
+	} else if errors.Is(err, context.DeadlineExceeded) {
+		return exitTimeout
+	}
+
+	if errors.Is(err, errLoginRequired) {
+		return exitUnauthorized
+	} else if errors.Is(err, errAuthExpired) || errors.Is(err, errTokenRejected) {
+		return exitAuthExpired
+	}
+
+	var apiError *mongohq.APIError
+	if errors.As(err, &apiError) {
+		switch apiError.Category {
+		case mongohq.ErrorValidation:
+			return exitValidation
+		case mongohq.ErrorNotFound:
+			return exitNotFound
+		case mongohq.ErrorUnauthorized:
+			return exitUnauthorized
+		case mongohq.ErrorServer:
+			return exitServer
+		case mongohq.ErrorNetwork:
+			return exitNetwork
+		}
 	}
+	return exitError
 }
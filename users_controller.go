@@ -2,21 +2,31 @@ package main
 
 import (
 	"fmt"
-	"os"
+	"github.com/MongoHQ/mongohq-cli/mongohq"
 )
 
-func (c *Controller) CurrentUser() {
-	user, err := c.Api.GetCurrentUser()
+// whoami is the whoami result for --format.
+type whoami struct {
+	mongohq.User
+	Profile string `json:"profile"`
+}
+
+func (c *Controller) CurrentUser() error {
+	user, err := c.Api.GetCurrentUser(c.Context)
 
 	if err != nil {
-		fmt.Println("Error returning user: " + err.Error())
-		if !replMode {
-			os.Exit(1)
-		}
-		return
+		return fmt.Errorf("Error returning user: %w", err)
+	}
+
+	if c.Format != formatText {
+		rows := table{headers: []string{"NAME", "EMAIL", "PROFILE"}}
+		rows.add(user.Name, user.Email, activeProfile)
+		return c.render(whoami{User: user, Profile: activeProfile}, rows)
 	}
 
-	fmt.Println("== whoami")
-	fmt.Println("  name  : " + user.Name)
-	fmt.Println("  email : " + user.Email)
+	fmt.Fprintln(c.Out, "== whoami")
+	fmt.Fprintln(c.Out, "  name    : "+user.Name)
+	fmt.Fprintln(c.Out, "  email   : "+user.Email)
+	fmt.Fprintln(c.Out, "  profile : "+activeProfile)
+	return nil
 }
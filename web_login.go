@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/MongoHQ/mongohq-cli/mongohq"
+	"net"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// How a profile logs in, kept in its defaults so that logging in again
+// after the token expires takes the same route.
+const (
+	loginPassword = ""
+	loginWeb      = "web"
+	loginDevice   = "device"
+)
+
+// webLoginTimeout bounds the wait for the browser or the device approval.
+var webLoginTimeout = 5 * time.Minute
+
+// webAuthenticate logs in through the browser with an authorization-code
+// grant and PKCE.  The browser is sent back to a one-off server on the
+// loopback interface, which receives the code.
+func (c *LoginController) webAuthenticate(ctx context.Context) (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", fmt.Errorf("Error starting the login callback server: %w", err)
+	}
+	redirectUri := "http://127.0.0.1:" + strconv.Itoa(listener.Addr().(*net.TCPAddr).Port) + "/callback"
+
+	verifier, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	state, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	authorizeUrl := c.Api.AuthorizeUrl(redirectUri, state, base64.RawURLEncoding.EncodeToString(challenge[:]))
+
+	type callback struct {
+		code string
+		err  error
+	}
+	callbacks := make(chan callback, 1)
+
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/callback" {
+			http.NotFound(w, r)
+			return
+		}
+
+		query := r.URL.Query()
+		var result callback
+		if query.Get("state") != state {
+			result.err = errors.New("The browser login did not match this one; please try again.")
+		} else if query.Get("error") != "" {
+			result.err = errors.New("The browser login failed: " + query.Get("error"))
+		} else {
+			result.code = query.Get("code")
+		}
+
+		if result.err != nil {
+			http.Error(w, result.err.Error(), http.StatusBadRequest)
+		} else {
+			fmt.Fprintln(w, "Logged in to MongoHQ.  You can close this window and return to the terminal.")
+		}
+
+		select {
+		case callbacks <- result:
+		default:
+		}
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	fmt.Fprintln(c.Out, "Opening your browser to log in.  If it does not open, visit:\n\n  "+authorizeUrl+"\n")
+	openBrowser(authorizeUrl)
+
+	var result callback
+	select {
+	case result = <-callbacks:
+	case <-time.After(webLoginTimeout):
+		return "", errors.New("Timed out waiting for the browser login.")
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	if result.err != nil {
+		return "", result.err
+	}
+
+	return c.Api.ExchangeCode(ctx, result.code, redirectUri, verifier)
+}
+
+// deviceAuthenticate logs in with a device-code grant, for machines without
+// a browser: the user approves the login from any other device.
+func (c *LoginController) deviceAuthenticate(ctx context.Context) (string, error) {
+	deviceCode, err := c.Api.RequestDeviceCode(ctx)
+	if err != nil {
+		return "", fmt.Errorf("Error starting device login: %w", err)
+	}
+
+	fmt.Fprintln(c.Out, "To log in, visit "+deviceCode.VerificationUri+" on any device and enter the code:\n\n  "+deviceCode.UserCode+"\n")
+
+	interval := time.Duration(deviceCode.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	expiresIn := webLoginTimeout
+	if deviceCode.ExpiresIn > 0 {
+		expiresIn = time.Duration(deviceCode.ExpiresIn) * time.Second
+	}
+	deadline := time.Now().Add(expiresIn)
+
+	for time.Now().Before(deadline) {
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+
+		token, err := c.Api.PollDeviceToken(ctx, deviceCode.DeviceCode)
+		if err == mongohq.ErrAuthorizationPending {
+			continue
+		} else if err == mongohq.ErrSlowDown {
+			interval += 5 * time.Second
+			continue
+		}
+		return token, err
+	}
+	return "", errors.New("Timed out waiting for the device login to be approved.")
+}
+
+// storeWebLogin looks up who the new token belongs to, then stores it the
+// same way as a password login.
+func (c *LoginController) storeWebLogin(ctx context.Context, token string) error {
+	c.Api.SetToken(token)
+
+	user, err := c.withoutReauthentication().GetCurrentUser(ctx)
+	if err != nil {
+		return fmt.Errorf("Error returning user after authentication: %w", err)
+	}
+
+	return c.storeCredentials(user.Email, token)
+}
+
+func randomToken(length int) (string, error) {
+	data := make([]byte, length)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// openBrowser is best effort; the url is printed as well.
+func openBrowser(url string) error {
+	var command *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		command = exec.Command("open", url)
+	case "windows":
+		command = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		command = exec.Command("xdg-open", url)
+	}
+	return command.Start()
+}